@@ -1,193 +1,516 @@
 package art
 
 import (
+	"bytes"
 	"trees/utils"
 )
 
-type ArtTree struct {
-	root *node
+// 值类型为 V 的自适应基数树
+type Tree[V any] struct {
+	root *node[V]
 	size int
+	opts options
 }
 
+// 兼容存储 interface{} 的旧版 API
+type ArtTree = Tree[interface{}]
+
 // 创建空树
-func NewArtTree() *ArtTree {
-	return &ArtTree{root: nil, size: 0}
+func New[V any](opts ...Option) *Tree[V] {
+	t := &Tree[V]{root: nil, size: 0, opts: defaultOptions()}
+	for _, opt := range opts {
+		opt(&t.opts)
+	}
+	return t
+}
+
+func NewArtTree(opts ...Option) *ArtTree {
+	return New[interface{}](opts...)
+}
+
+// 创建叶子节点，未开启零拷贝时拷贝 key，不能引用调用方的内存
+func (t *Tree[V]) newLeaf(key []byte, val V) *node[V] {
+	if !t.opts.zeroCopyKeys {
+		key = cp(key)
+	} else if key == nil {
+		key = []byte{} // 存储的空 key 总是返回非 nil 的空切片，与查找不到的 nil 区分
+	}
+	return newLeaf(key, val)
+}
+
+// 新增或更新，等价于忽略返回值的 Put
+func (t *Tree[V]) Insert(key []byte, val V) {
+	t.Put(key, val)
+}
+
+// 新增或更新，replaced 标识 key 是否已存在，old 为被覆盖的旧值
+func (t *Tree[V]) Put(key []byte, val V) (old V, replaced bool) {
+	return t.insert(t.root, &t.root, 0, key, val, true)
 }
 
-func (t *ArtTree) Insert(key []byte, val interface{}) {
-	key = appendNULL(key)
-	t.insert(t.root, &t.root, 0, key, val)
+// 仅在 key 不存在时写入，loaded 标识 key 是否已存在，existing 为已存在的值
+func (t *Tree[V]) PutIfAbsent(key []byte, val V) (existing V, loaded bool) {
+	return t.insert(t.root, &t.root, 0, key, val, false)
 }
 
 // 递归遍历 key 直到遇到叶子节点
 // 处理 lazy expansion 和 mismatch
-func (t *ArtTree) insert(cur *node, curRef **node, depth int, key []byte, val interface{}) {
+// key 已存在时返回其旧值，并根据 overwrite 决定是否覆盖
+// key 可以在任意深度结束：恰好在内部节点前缀处结束的 key 存为该节点的 leaf，而非用 \0 结尾占一个子节点
+func (t *Tree[V]) insert(cur *node[V], curRef **node[V], depth int, key []byte, val V, overwrite bool) (old V, ok bool) {
 	// 1. 空树或空叶子节点
 	if cur == nil {
-		*curRef = newLeaf(key, val)
+		*curRef = t.newLeaf(key, val)
 		t.size++
 		return
 	}
 
 	// 2. 处理叶子节点的 lazy expansion
 	if cur.isLeaf() {
-		// 2.1. key 存在则先返回
-		if cur.isMatch(key) {
-			return
+		// 2.1. key 存在则更新
+		curLeaf := cur.asLeaf()
+		if curLeaf.isMatch(key) {
+			old = curLeaf.val
+			if overwrite {
+				curLeaf.val = val
+			}
+			return old, true
 		}
 
 		// 2.2. 当前节点会被公共前缀父节点替换掉，当前节点切割公共前缀后，与新叶子节点一起连接到该父节点
-		leaf := newLeaf(key, val)
-		commonLen := cur.matchPrefixLen(leaf, depth)
+		leaf := t.newLeaf(key, val)
+		commonLen := curLeaf.matchPrefixLen(leaf.asLeaf(), depth)
 
-		parent := newNode4()
-		parent.prefixLen = commonLen // 当前深度的公共前缀长度
-		utils.Memcpy(parent.prefix, key[depth:depth+commonLen], utils.Min(commonLen, MAX_PREFIX_LEN))
+		parent := newNode4[V]()
+		parent.prefixLen = uint32(commonLen) // 当前深度的公共前缀长度
+		utils.Memcpy(parent.prefix[:], key[depth:depth+commonLen], utils.Min(commonLen, t.opts.prefixLen))
 
-		// 节点替换，用第一个字节作为 key 建立 childs 指针
-		*curRef = parent
-		parent.addChild(cur.key[depth+commonLen], cur)
-		parent.addChild(key[depth+commonLen], leaf)
+		// 节点替换，用第一个字节作为 key 建立 childs 指针，恰好是公共前缀的 key 则挂到 parent.leaf
+		*curRef = &parent.node
+		parent.addLeaf(curRef, depth+commonLen, cur)
+		parent.addLeaf(curRef, depth+commonLen, leaf)
 
 		t.size++
 		return
 	}
 
 	// 3. 处理内部节点的分裂
-	diffIdx := cur.mismatchPrefixLen(key, depth)
-	if diffIdx != cur.prefixLen {
-		parent := newNode4() // 分裂父节点
+	in := cur.asInner()
+	diffIdx := in.mismatchPrefixLen(key, depth, t.opts.prefixLen)
+	if diffIdx != int(in.prefixLen) {
+		parent := newNode4[V]() // 分裂父节点
+		*curRef = &parent.node
 
 		// 添加叶子节点
-		leaf := newLeaf(key, val)
-		parent.addChild(key[depth+diffIdx], leaf)
-
-		// 添加当前节点
-		// 拷贝前缀到父节点
-		parent.prefixLen = diffIdx // 注意此处 index 和 len 的关系是相等的
-		utils.Memcpy(parent.prefix, cur.prefix, diffIdx)
-
-		if cur.prefixLen < MAX_PREFIX_LEN {
-			// 在当前节点的部分前缀匹配成功
-			cur.prefixLen -= diffIdx + 1 // 1: diffKey
-			parent.addChild(cur.prefix[diffIdx], cur)
-			utils.Memmove(cur.prefix, cur.prefix[(diffIdx+1):], cur.prefixLen) // 之后 prefixLen 和 prefix 是同步的
-		} else {
-			cur.prefixLen -= diffIdx + 1
-			// 从子节点拿完整的 key 来做前缀匹配
-			leftestLeaf := cur.minChild()
-			parent.addChild(leftestLeaf.key[depth+diffIdx], cur)
-			utils.Memmove(cur.prefix, leftestLeaf.key[depth+diffIdx+1:], utils.Min(cur.prefixLen, MAX_PREFIX_LEN))
+		leaf := t.newLeaf(key, val)
+		parent.addLeaf(curRef, depth+diffIdx, leaf)
+
+		// 完整前缀：悲观模式下 prefix 存有全部前缀，乐观模式下只存了一部分，需从子节点拿完整的 key
+		fullPrefix := in.prefix[:]
+		if int(in.prefixLen) > t.opts.prefixLen {
+			fullPrefix = cur.minChild().key[depth : depth+int(in.prefixLen)]
 		}
 
-		*curRef = parent
+		// 分裂点之前的前缀拷贝到父节点
+		parent.prefixLen = uint32(diffIdx) // 注意此处 index 和 len 的关系是相等的
+		copy(parent.prefix[:], fullPrefix[:diffIdx])
+
+		// 分裂点作为当前节点在父节点中的 key，之后的前缀留给当前节点
+		// 1: diffKey，之后 prefixLen 和 prefix 是同步的
+		parent.addChild(curRef, fullPrefix[diffIdx], cur)
+		in.prefixLen -= uint32(diffIdx + 1)
+		copy(in.prefix[:], fullPrefix[diffIdx+1:])
+
 		t.size++
 		return
 	}
 
-	// 4. 处理一般情况：跳过当前内部节点，继续下沉寻找目标叶子节点
-	depth += cur.prefixLen
+	// 4. key 恰好在当前节点的前缀处结束
+	depth += int(in.prefixLen)
+	if depth == len(key) {
+		return t.insert(in.leaf, &in.leaf, depth, key, val, overwrite)
+	}
+
+	// 5. 处理一般情况：跳过当前内部节点，继续下沉寻找目标叶子节点
 	next := cur.key2childRef(key[depth])
-	if *next == nil {
+	if next == nil {
 		// 找到叶子节点的目标位置
-		cur.addChild(key[depth], newLeaf(key, val))
+		cur.addChild(curRef, key[depth], t.newLeaf(key, val))
 		t.size++
 		return
 	}
 
 	// 继续下沉
-	t.insert(*next, next, depth+1, key, val)
+	return t.insert(*next, next, depth+1, key, val, overwrite)
+}
+
+// 查找 key，不存在则返回 V 的零值
+func (t *Tree[V]) Search(key []byte) V {
+	v, _ := t.Get(key)
+	return v
 }
 
-func (t *ArtTree) Search(key []byte) interface{} {
-	key = appendNULL(key)
+// 查找 key，ok 标识 key 是否存在
+func (t *Tree[V]) Get(key []byte) (v V, ok bool) {
 	return t.search(t.root, key, 0)
 }
 
-func (t *ArtTree) search(n *node, key []byte, depth int) interface{} {
+func (t *Tree[V]) search(n *node[V], key []byte, depth int) (v V, ok bool) {
 	if n == nil {
-		return nil
+		return v, false
 	}
 	if n.isLeaf() {
-		if n.isMatch(key) {
-			return n.val
+		if l := n.asLeaf(); l.isMatch(key) {
+			return l.val, true
 		}
-		return nil
+		return v, false
 	}
-	diffIdx := n.mismatchPrefixLen(key, depth)
-	// 在 n 节点内部不匹配
-	if diffIdx != n.prefixLen {
-		return nil
+	in := n.asInner()
+	// 在 n 节点内部不匹配，乐观跳过的部分由叶子节点校验
+	if !in.checkPrefix(key, depth, t.opts.prefixLen) {
+		return v, false
 	}
 
-	depth += n.prefixLen
-	next := n.key2childRef(key[depth])
-	return t.search(*next, key, depth+1)
+	depth += int(in.prefixLen)
+	if depth == len(key) {
+		return t.search(in.leaf, key, depth)
+	}
+	return t.search(n.findChild(key[depth]), key, depth+1)
 }
 
-func (t *ArtTree) Delete(key []byte) bool {
-	key = appendNULL(key)
-	return t.delete(t.root, nil, 0, key)
+// 最长的、是 key 前缀的已存储 key，不存在则 ok 为 false
+// 沿 key 下沉，途经节点的 leaf 恰好在前缀处结束，是候选的前缀；乐观跳过的前缀由候选叶子的完整 key 校验
+func (t *Tree[V]) LongestPrefix(key []byte) (k []byte, v V, ok bool) {
+	var last *leaf[V]
+	n, depth := t.root, 0
+	for n != nil {
+		if n.isLeaf() {
+			if l := n.asLeaf(); bytes.HasPrefix(key, l.key) {
+				last = l
+			}
+			break
+		}
+		in := n.asInner()
+		if !in.checkPrefix(key, depth, t.opts.prefixLen) {
+			break
+		}
+		depth += int(in.prefixLen)
+		if in.leaf != nil {
+			if l := in.leaf.asLeaf(); bytes.HasPrefix(key, l.key) {
+				last = l
+			}
+		}
+		if depth == len(key) {
+			break
+		}
+		n = n.findChild(key[depth])
+		depth++
+	}
+	if last == nil {
+		return nil, v, false
+	}
+	return last.key, last.val, true
 }
 
-func (t *ArtTree) delete(cur *node, parent *node, depth int, key []byte) bool {
+// 删除 key，ok 标识 key 是否存在，old 为被删除的值
+func (t *Tree[V]) Delete(key []byte) (old V, ok bool) {
+	return t.delete(&t.root, nil, 0, key)
+}
+
+// ref 为指向当前节点的槽位，parentRef 为指向父节点的槽位，父节点收缩后需写回
+func (t *Tree[V]) delete(ref, parentRef **node[V], depth int, key []byte) (old V, ok bool) {
 	// search leaf node and delete it
+	cur := *ref
 	if cur == nil {
-		return false
-	}
-
-	diffIdx := cur.mismatchPrefixLen(key, depth)
-	if diffIdx != cur.prefixLen {
-		return false
+		return
 	}
 
 	if cur.isLeaf() {
-		if !cur.isMatch(key) {
-			return false
+		l := cur.asLeaf()
+		if !l.isMatch(key) {
+			return
 		}
-		if parent == nil {
-			return false // TODO: delete root
+		t.size--
+		if parentRef == nil {
+			*ref = nil // root 即唯一的叶子
+			return l.val, true
 		}
+
 		// 1. 删除叶子节点
-		leafPrefixKey := key[depth]
-		parent.delete(leafPrefixKey)
-		parent.size--
-		t.size--
+		parent := *parentRef
+		if in := parent.asInner(); ref == &in.leaf {
+			in.leaf = nil // key 恰好在父节点前缀处结束
+		} else {
+			parent.delete(key[depth-1])
+		}
 
 		// 2. 收缩
-		if parent.isEmpty() {
-			parent.shrink()
-		}
-		return true
+		t.shrink(parentRef)
+		return l.val, true
 	}
 
-	depth += cur.prefixLen
+	in := cur.asInner()
+	if !in.checkPrefix(key, depth, t.opts.prefixLen) {
+		return
+	}
+
+	depth += int(in.prefixLen)
+	if depth == len(key) {
+		return t.delete(&in.leaf, ref, depth, key)
+	}
 	next := cur.key2childRef(key[depth])
-	return t.delete(*next, cur, depth, key) // depth 作为 key 的索引使用，先 +1 再 -1
+	if next == nil {
+		return
+	}
+	return t.delete(next, ref, depth+1, key)
 }
 
-func (t *ArtTree) Size() int {
-	return t.size
+// 删除子节点后收缩 ref 处的节点，滞后收缩时一次可能需要收缩多级
+func (t *Tree[V]) shrink(ref **node[V]) {
+	n := *ref
+	for n.isEmpty(t.opts.shrinkHysteresis) {
+		next := n.shrink(t.opts.prefixLen)
+		if next == n {
+			break
+		}
+		if n = next; n.isLeaf() {
+			break
+		}
+	}
+	*ref = n
 }
 
-func (t *ArtTree) Dump() map[string]interface{} {
-	var traverse func(n *node, m map[string]interface{})
-	traverse = func(n *node, m map[string]interface{}) {
+// 删除所有以 prefix 为前缀的 key，返回删除的数量
+// 与 prefixNode 相同地下沉到覆盖 prefix 的最高节点，整棵子树一次摘除，父节点只收缩一次
+func (t *Tree[V]) DeletePrefix(prefix []byte) int {
+	var parentRef **node[V]
+	var k byte
+	ref, depth := &t.root, 0
+	for {
+		n := *ref
 		if n == nil {
-			return
+			return 0
 		}
 		if n.isLeaf() {
-			m[string(n.key)] = n.val
-		}
-		for _, k := range n.keys {
-			child := *(n.key2childRef(k))
-			if child != nil {
-				traverse(child, m)
+			if !bytes.HasPrefix(n.asLeaf().key, prefix) {
+				return 0
 			}
+			break
 		}
+		if depth == len(prefix) {
+			break
+		}
+
+		prefixLen := int(n.asInner().prefixLen)
+		fullPrefix := t.fullPrefix(n, depth)
+		l := utils.Min(len(prefix)-depth, prefixLen)
+		if !bytes.Equal(prefix[depth:depth+l], fullPrefix[:l]) {
+			return 0
+		}
+		depth += prefixLen
+		if depth >= len(prefix) {
+			break // prefix 在当前节点的压缩前缀内结束
+		}
+		k = prefix[depth]
+		parentRef, ref = ref, n.key2childRef(k)
+		if ref == nil {
+			return 0
+		}
+		depth++
+	}
+
+	cnt := 0
+	(*ref).walk(func(*leaf[V]) bool {
+		cnt++
+		return true
+	})
+	if parentRef == nil {
+		t.Clear() // root 的子树即整棵树
+		return cnt
 	}
+	(*parentRef).delete(k)
+	t.shrink(parentRef)
+	t.size -= cnt
+	return cnt
+}
+
+// 删除所有 key，节点交给 GC 回收
+func (t *Tree[V]) Clear() {
+	t.root = nil
+	t.size = 0
+}
 
-	m := make(map[string]interface{})
-	traverse(t.root, m)
+func (t *Tree[V]) Size() int {
+	return t.size
+}
+
+func (t *Tree[V]) Dump() map[string]V {
+	m := make(map[string]V)
+	for k, v := range t.All() {
+		m[string(k)] = v
+	}
 	return m
 }
+
+// 最小 key，空树则 k 为 nil
+func (t *Tree[V]) Min() (k []byte, v V) {
+	if t.root == nil {
+		return nil, v
+	}
+	leaf := t.root.minChild()
+	return leaf.key, leaf.val
+}
+
+// 最大 key，空树则 k 为 nil
+func (t *Tree[V]) Max() (k []byte, v V) {
+	if t.root == nil {
+		return nil, v
+	}
+	leaf := t.root.maxChild()
+	return leaf.key, leaf.val
+}
+
+// 最后一个 <= key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Floor(key []byte) (k []byte, v V) {
+	it := &Iterator[V]{tree: t}
+	if it.SeekForPrev(key) {
+		return it.Key(), it.Value()
+	}
+	return nil, v
+}
+
+// 第一个 >= key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Ceiling(key []byte) (k []byte, v V) {
+	it := &Iterator[V]{tree: t}
+	if it.Seek(key) {
+		return it.Key(), it.Value()
+	}
+	return nil, v
+}
+
+// 最后一个 < key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Lower(key []byte) (k []byte, v V) {
+	it := &Iterator[V]{tree: t}
+	ok := it.Seek(key)
+	if ok {
+		ok = it.Prev() // 第一个 >= key 的前一个即 < key
+	} else {
+		ok = it.SeekToLast() // 所有 key 都 < key
+	}
+	if ok {
+		return it.Key(), it.Value()
+	}
+	return nil, v
+}
+
+// 第一个 > key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Higher(key []byte) (k []byte, v V) {
+	it := &Iterator[V]{tree: t}
+	ok := it.Seek(key)
+	if ok && bytes.Equal(it.Key(), key) {
+		ok = it.Next()
+	}
+	if ok {
+		return it.Key(), it.Value()
+	}
+	return nil, v
+}
+
+// 删除并返回最小 key，空树则 k 为 nil
+func (t *Tree[V]) PopMin() (k []byte, v V) {
+	if k, v = t.Min(); k != nil {
+		t.Delete(k) // 叶子被摘除后不再引用 k，可直接返回给调用方
+	}
+	return k, v
+}
+
+// 删除并返回最大 key，空树则 k 为 nil
+func (t *Tree[V]) PopMax() (k []byte, v V) {
+	if k, v = t.Max(); k != nil {
+		t.Delete(k)
+	}
+	return k, v
+}
+
+// 升序遍历 [start, end) 内的 key，start 为 nil 则从最小 key 开始，end 为 nil 则遍历到最大 key
+// 先 Seek 到 start 再逐个后移，区间外的子树不会被访问；fn 返回 false 则提前结束
+func (t *Tree[V]) Range(start, end []byte, fn func(k []byte, v V) bool) {
+	it := &Iterator[V]{tree: t}
+	ok := it.SeekToFirst()
+	if start != nil {
+		ok = it.Seek(start)
+	}
+	for ; ok; ok = it.Next() {
+		if end != nil && bytes.Compare(it.Key(), end) >= 0 {
+			return
+		}
+		if !fn(it.Key(), it.Value()) {
+			return
+		}
+	}
+}
+
+// 升序遍历所有以 prefix 为前缀的 key，fn 返回 false 则提前结束
+func (t *Tree[V]) WalkPrefix(prefix []byte, fn func(k []byte, v V) bool) {
+	if n := t.prefixNode(prefix); n != nil {
+		n.walk(func(l *leaf[V]) bool {
+			return fn(l.key, l.val)
+		})
+	}
+}
+
+func (t *Tree[V]) HasPrefix(prefix []byte) bool {
+	return t.prefixNode(prefix) != nil
+}
+
+func (t *Tree[V]) CountPrefix(prefix []byte) int {
+	cnt := 0
+	if n := t.prefixNode(prefix); n != nil {
+		n.walk(func(*leaf[V]) bool {
+			cnt++
+			return true
+		})
+	}
+	return cnt
+}
+
+// 内部节点 n 在 depth 处的完整压缩前缀
+// 悲观模式下 prefix 存有全部前缀，乐观模式下只存了一部分，才需从最左叶子节点拿完整的 key，避免每层都下沉到叶子
+func (t *Tree[V]) fullPrefix(n *node[V], depth int) []byte {
+	in := n.asInner()
+	if int(in.prefixLen) > t.opts.prefixLen {
+		return n.minChild().key[depth : depth+int(in.prefixLen)]
+	}
+	return in.prefix[:in.prefixLen]
+}
+
+// 下沉到覆盖 prefix 的最高节点，其子树中的 key 均以 prefix 为前缀
+func (t *Tree[V]) prefixNode(prefix []byte) *node[V] {
+	n := t.root
+	depth := 0
+	for n != nil {
+		if n.isLeaf() {
+			if bytes.HasPrefix(n.asLeaf().key, prefix) {
+				return n
+			}
+			return nil
+		}
+		if depth == len(prefix) {
+			return n
+		}
+
+		prefixLen := int(n.asInner().prefixLen)
+		fullPrefix := t.fullPrefix(n, depth)
+		l := utils.Min(len(prefix)-depth, prefixLen)
+		if !bytes.Equal(prefix[depth:depth+l], fullPrefix[:l]) {
+			return nil
+		}
+		depth += prefixLen
+		if depth >= len(prefix) {
+			return n // prefix 在当前节点的压缩前缀内结束
+		}
+		n = n.findChild(prefix[depth])
+		depth++
+	}
+	return nil
+}
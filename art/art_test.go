@@ -1,10 +1,25 @@
 package art
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"github.com/k0kubun/pp"
 	"github.com/stretchr/testify/assert"
+	"iter"
+	"maps"
+	"math/rand"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+	"trees"
+	"trees/conformance"
 	"trees/utils"
+	"unsafe"
 )
 
 //
@@ -15,9 +30,8 @@ func TestArtBasic(t *testing.T) {
 	t1 := NewArtTree()
 	t1.Insert([]byte("ab"), "AB")
 	assert.Equal(t, t1.Size(), 1)
-	assert.Equal(t, t1.root.size, 0)
 	assert.Equal(t, t1.root.nodeType, LEAF)
-	assert.Equal(t, t1.root.key, []byte{'a', 'b', 0x00}) // 尾部要加上空字节
+	assert.Equal(t, t1.root.asLeaf().key, []byte{'a', 'b'}) // key 原样存储，不再追加 0x00
 	assert.Equal(t, t1.Search([]byte("ab")), "AB")
 
 	// search
@@ -31,6 +45,88 @@ func TestArtBasic(t *testing.T) {
 	assert.Equal(t, t1.Search([]byte("ac")), "AC")
 }
 
+func TestGeneric(t *testing.T) {
+	tree := New[int]()
+	tree.Insert([]byte("a"), 0)
+	tree.Insert([]byte("ab"), 1)
+
+	v, ok := tree.Get([]byte("a"))
+	assert.True(t, ok)
+	assert.Equal(t, 0, v) // 存储的零值与未命中可通过 ok 区分
+	v, ok = tree.Get([]byte("b"))
+	assert.False(t, ok)
+	assert.Equal(t, 0, v)
+	assert.Equal(t, 1, tree.Search([]byte("ab")))
+}
+
+//
+// 二进制 key case
+//
+func TestBinaryKeys(t *testing.T) {
+	tree := NewArtTree()
+	keys := [][]byte{
+		{}, {0x00}, {0x00, 0x00}, {0x00, 0x00, 0x00}, {0x00, 0x01}, {0x01}, {0xff}, {0xff, 0x00},
+		[]byte("a"), []byte("a\x00"), []byte("a\x00b"), []byte("a\x00\x00"), []byte("ab"), []byte("ab\x00"),
+	}
+	for i, k := range keys {
+		tree.Insert(k, i)
+	}
+	assert.Equal(t, len(keys), tree.Size())
+	for i, k := range keys {
+		v, ok := tree.Get(k)
+		assert.True(t, ok, "key %q", k)
+		assert.Equal(t, i, v, "key %q", k)
+	}
+	_, ok := tree.Get([]byte{0x00, 0x00, 0x00, 0x00})
+	assert.False(t, ok)
+	_, ok = tree.Get([]byte("a\x00b\x00"))
+	assert.False(t, ok)
+
+	// 互为前缀的 key 按字节序排列，较短的在前
+	sorted := append([][]byte{}, keys...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	var got [][]byte
+	for k := range tree.All() {
+		got = append(got, k)
+	}
+	assert.Equal(t, sorted, got)
+	got = got[:0]
+	for k := range tree.Backward() {
+		got = append([][]byte{k}, got...)
+	}
+	assert.Equal(t, sorted, got)
+	assert.Equal(t, []byte("a\x00\x00"), func() []byte {
+		it := tree.Iterator()
+		it.SeekForPrev([]byte("a\x00a"))
+		return it.Key()
+	}())
+	assert.Equal(t, 3, tree.CountPrefix([]byte("a\x00")))
+
+	// 删除内部节点上的 leaf
+	old, ok := tree.Delete([]byte("a\x00"))
+	assert.True(t, ok)
+	assert.Equal(t, 9, old)
+	_, ok = tree.Get([]byte("a\x00"))
+	assert.False(t, ok)
+	assert.Equal(t, 10, tree.Search([]byte("a\x00b")))
+	assert.Equal(t, 11, tree.Search([]byte("a\x00\x00")))
+	assert.Equal(t, len(keys)-1, tree.Size())
+}
+
+func TestZeroAlloc(t *testing.T) {
+	tree := New[int]()
+	for _, s := range utils.RandStrs(1000, 1, 10) {
+		tree.Insert([]byte(s), len(s))
+	}
+	hit, miss := []byte("abc"), []byte("abcdefghijk")
+	tree.Insert(hit, 3)
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		tree.Get(hit)
+		tree.Get(miss)
+		tree.Put(hit, 3) // 更新已存在的 key
+	}))
+}
+
 //
 // 膨胀 case
 //
@@ -69,9 +165,141 @@ func TestNodeExpansion(t *testing.T) {
 	// NODE48 -> NODE256
 	insertRange(t1, 48, 49)
 	assert.Equal(t, t1.root.nodeType, NODE256)
-	insertRange(t1, 49, 255)
+	insertRange(t1, 49, 256)
 	assert.True(t, t1.root.isFull())
-	pp.Println(t1.root.keys)
+	pp.Println(t1.root.asInner().size)
+
+	// NODE256 可容纳全部 256 个字节
+	assert.Equal(t, 256, t1.Size())
+	for i := 0; i < 256; i++ {
+		assert.Equal(t, byte(i), t1.Search([]byte{byte(i)}))
+	}
+	i := 0
+	for k := range t1.All() {
+		assert.Equal(t, []byte{byte(i)}, k)
+		i++
+	}
+	assert.Equal(t, 256, i)
+	it := t1.Iterator()
+	assert.True(t, it.SeekToLast())
+	assert.Equal(t, []byte{0xff}, it.Key())
+
+	// 收缩到 NODE48 后 0xff 依旧存在，且能被删除
+	for i := 0; i < 256-MAX_NODE48; i++ {
+		t1.Delete([]byte{byte(i)})
+	}
+	assert.Equal(t, NODE48, t1.root.nodeType)
+	for i := 256 - MAX_NODE48; i < 256; i++ {
+		assert.Equal(t, byte(i), t1.Search([]byte{byte(i)}))
+	}
+	_, ok := t1.Delete([]byte{0xff})
+	assert.True(t, ok)
+	assert.Equal(t, MAX_NODE48-1, t1.Size())
+}
+
+// NODE16 的 SIMD 与 SWAR 查找需与逐个比较的结果一致
+func TestNode16Search(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 2000; round++ {
+		size := r.Intn(MAX_NODE16 + 1)
+		var keys [16]byte
+		for i, k := range r.Perm(256)[:size] {
+			keys[i] = byte(k)
+		}
+		sort.Slice(keys[:size], func(i, j int) bool { return keys[i] < keys[j] })
+		for i := size; i < 16; i++ {
+			keys[i] = byte(r.Intn(256)) // size 之后的脏数据不能影响结果
+		}
+		for k := 0; k < 256; k++ {
+			want := linearFindKey16(&keys, byte(k), size)
+			assert.Equal(t, want, findKey16(&keys, byte(k), size))
+			assert.Equal(t, want, findKey16SWAR(&keys, byte(k), size))
+			want = linearUpperBound16(&keys, byte(k), size)
+			assert.Equal(t, want, upperBound16(&keys, byte(k), size))
+			assert.Equal(t, want, upperBound16SWAR(&keys, byte(k), size))
+		}
+	}
+}
+
+func linearFindKey16(keys *[16]byte, k byte, size int) int {
+	for i := 0; i < size; i++ {
+		if keys[i] == k {
+			return i
+		}
+	}
+	return -1
+}
+
+func linearUpperBound16(keys *[16]byte, k byte, size int) int {
+	for i := 0; i < size; i++ {
+		if k < keys[i] {
+			return i
+		}
+	}
+	return size
+}
+
+//
+// 删除 case
+//
+func TestDelete(t *testing.T) {
+	// 删除 root 叶子
+	tree := NewArtTree()
+	tree.Insert([]byte("a"), 1)
+	old, ok := tree.Delete([]byte("a"))
+	assert.True(t, ok)
+	assert.Equal(t, 1, old)
+	assert.Nil(t, tree.root)
+	assert.Equal(t, 0, tree.Size())
+
+	// NODE4 合并唯一子节点时，需保留指向子节点的 key
+	tree.Insert([]byte("abcX1"), 1)
+	tree.Insert([]byte("abcX2"), 2)
+	tree.Insert([]byte("abcY"), 3)
+	tree.Delete([]byte("abcY"))
+	assert.Equal(t, NODE4, tree.root.nodeType)
+	assert.Equal(t, uint32(4), tree.root.asInner().prefixLen)
+	assert.Equal(t, []byte("abcX"), tree.root.asInner().prefix[:4])
+	assert.Equal(t, 1, tree.Search([]byte("abcX1")))
+	assert.Equal(t, 2, tree.Search([]byte("abcX2")))
+
+	// 逐级收缩 NODE256 -> NODE48 -> NODE16 -> NODE4 -> LEAF -> nil
+	tree = NewArtTree()
+	for i := 0; i < 200; i++ {
+		tree.Insert([]byte{byte(i)}, i)
+	}
+	assert.Equal(t, NODE256, tree.root.nodeType)
+	for i, want := range map[int]nodeType{48: NODE48, 16: NODE16, 4: NODE4, 1: LEAF} {
+		tree := NewArtTree()
+		for j := 0; j < 200; j++ {
+			tree.Insert([]byte{byte(j)}, j)
+		}
+		for j := i; j < 200; j++ {
+			_, ok := tree.Delete([]byte{byte(j)})
+			assert.True(t, ok)
+		}
+		assert.Equal(t, want, tree.root.nodeType)
+		assert.Equal(t, i, tree.Size())
+		for j := 0; j < i; j++ {
+			assert.Equal(t, j, tree.Search([]byte{byte(j)}))
+		}
+	}
+
+	// 删除全部 key 后为空树
+	tree = NewArtTree()
+	m := make(map[string]bool)
+	for _, s := range utils.RandStrs(2000, 1, 6) {
+		m[s] = true
+		tree.Insert([]byte(s), s)
+	}
+	for s := range m {
+		_, ok := tree.Delete([]byte(s))
+		assert.True(t, ok, "delete %q", s)
+		_, ok = tree.Get([]byte(s))
+		assert.False(t, ok)
+	}
+	assert.Equal(t, 0, tree.Size())
+	assert.Nil(t, tree.root)
 }
 
 //
@@ -101,3 +329,800 @@ func TestFailCase(t *testing.T) {
 	}
 	pp.Println(tree.Search([]byte("tjzq")))
 }
+
+//
+// 迭代器 case
+//
+func TestIterator(t *testing.T) {
+	tree := NewArtTree()
+	assert.False(t, tree.Iterator().SeekToFirst())
+	assert.False(t, tree.Iterator().Seek([]byte("a")))
+
+	// 单字节 key 使 root 膨胀为 NODE256，双字节 key 使子节点覆盖 NODE4 到 NODE48
+	var keys [][]byte
+	for i := 1; i < 255; i += 2 {
+		keys = append(keys, []byte{byte(i)})
+	}
+	for i := 0; i < 30; i++ {
+		keys = append(keys, []byte{'x', byte(3*i + 1)})
+	}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, []byte{'y', byte(i + 1), 'z'})
+	}
+	for _, k := range keys {
+		tree.Insert(k, string(k))
+	}
+	assert.Equal(t, NODE256, tree.root.nodeType)
+	assert.Equal(t, NODE48, (*tree.root.key2childRef('x')).nodeType)
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	// 全量正反向遍历
+	var got [][]byte
+	for k, v := range tree.All() {
+		assert.Equal(t, string(k), v)
+		got = append(got, k)
+	}
+	assert.Equal(t, keys, got)
+	got = got[:0]
+	for k := range tree.Backward() {
+		got = append([][]byte{k}, got...)
+	}
+	assert.Equal(t, keys, got)
+	assert.Equal(t, len(keys), len(tree.Dump()))
+
+	// 游标双向移动
+	it := tree.Iterator()
+	assert.True(t, it.SeekToLast())
+	assert.Equal(t, keys[len(keys)-1], it.Key())
+	assert.True(t, it.Prev())
+	assert.Equal(t, keys[len(keys)-2], it.Key())
+	assert.True(t, it.Next())
+	assert.False(t, it.Next())
+	assert.False(t, it.Valid())
+
+	// Seek 与 SeekForPrev
+	lowerBound := func(k []byte) int {
+		return sort.Search(len(keys), func(i int) bool { return bytes.Compare(keys[i], k) >= 0 })
+	}
+	for _, k := range [][]byte{{0}, {1}, {2}, {'x'}, {'x', 4}, {'x', 200}, {'y', 3}, {'y', 3, 'z'}, {'y', 3, 'z', 'a'}, {254}, {255}} {
+		i := lowerBound(k)
+		if i == len(keys) {
+			assert.False(t, it.Seek(k))
+		} else {
+			assert.True(t, it.Seek(k))
+			assert.Equal(t, keys[i], it.Key(), "seek %v", k)
+		}
+
+		if i < len(keys) && bytes.Equal(keys[i], k) {
+			i++
+		}
+		if i == 0 {
+			assert.False(t, it.SeekForPrev(k))
+		} else {
+			assert.True(t, it.SeekForPrev(k))
+			assert.Equal(t, keys[i-1], it.Key(), "seek for prev %v", k)
+		}
+	}
+}
+
+//
+// 前缀查询 case
+//
+func TestPrefix(t *testing.T) {
+	tree := NewArtTree()
+	assert.False(t, tree.HasPrefix(nil))
+
+	// root 的公共前缀 "tenant-000" 超过 MAX_PREFIX_LEN，为乐观模式
+	keys := []string{"tenant-0001", "tenant-0001/a", "tenant-0001/b", "tenant-0002/x", "tenant-0002/y/z"}
+	for _, k := range keys {
+		tree.Insert([]byte(k), k)
+	}
+	assert.Equal(t, uint32(10), tree.root.asInner().prefixLen)
+
+	walk := func(prefix string) (got []string) {
+		tree.WalkPrefix([]byte(prefix), func(k []byte, v interface{}) bool {
+			got = append(got, string(k))
+			return true
+		})
+		return got
+	}
+	assert.Equal(t, keys, walk(""))
+	assert.Equal(t, keys, walk("tenant-0"))
+	assert.Equal(t, keys[:3], walk("tenant-0001"))
+	assert.Equal(t, keys[1:3], walk("tenant-0001/"))
+	assert.Equal(t, keys[4:], walk("tenant-0002/y/z"))
+	assert.Nil(t, walk("tenant-0002/y/z/"))
+	assert.Nil(t, walk("tenant-00x"))  // 在乐观前缀的后半段不匹配
+	assert.Nil(t, walk("tenant-0003")) // 子节点不存在
+
+	assert.True(t, tree.HasPrefix([]byte("tenant-000")))
+	assert.False(t, tree.HasPrefix([]byte("tenant-1")))
+	assert.Equal(t, 2, tree.CountPrefix([]byte("tenant-0002")))
+	assert.Equal(t, 1, tree.CountPrefix([]byte("tenant-0001/a")))
+}
+
+// 长度为 8、9、16、100+ 的压缩前缀，分别位于不同深度的节点上
+// 在前缀的各个位置分裂、在前缀中途结束，以及只在乐观部分不同的 key 都需与参考模型一致
+func TestLongPrefix(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, prefixLen := range []int{8, 9, 16, 100, 130} {
+		for _, depth := range []int{0, 1, 3, 12} {
+			head := make([]byte, depth)
+			r.Read(head)
+			prefix := make([]byte, prefixLen)
+			r.Read(prefix)
+			base := append(cp(head), prefix...) // 前缀节点的完整路径
+
+			var ops []conformance.Op
+			put := func(key []byte) {
+				ops = append(ops, conformance.Op{Kind: conformance.OpPut, Key: key, Val: len(ops)})
+			}
+			get := func(key []byte) {
+				ops = append(ops, conformance.Op{Kind: conformance.OpGet, Key: key})
+			}
+			if depth > 0 {
+				// 在 depth-1 处分叉，使前缀节点位于 depth 深度
+				put(append(cp(head[:depth-1]), head[depth-1]^0xff))
+			}
+			for _, suffix := range []string{"a", "b", "", "ab"} {
+				put(append(cp(base), suffix...))
+			}
+
+			// 在前缀的各个位置分裂，并在分裂点结束
+			for _, i := range []int{0, 1, 7, 8, 9, prefixLen / 2, prefixLen - 1} {
+				if i >= prefixLen {
+					continue
+				}
+				diff := cp(base)
+				diff[depth+i] ^= 0x01
+				get(diff) // 分裂前：只在该位置不同的 key 不能误判为存在
+				put(diff)
+				put(cp(base[:depth+i]))
+			}
+			for i := 0; i < prefixLen; i++ {
+				get(cp(base[:depth+i]))
+				miss := append(cp(base), 'a')
+				miss[depth+i] ^= 0x80
+				get(miss)
+			}
+
+			// 逐个删除，触发前缀合并
+			for _, op := range append([]conformance.Op(nil), ops...) {
+				if op.Kind == conformance.OpPut {
+					ops = append(ops, conformance.Op{Kind: conformance.OpDelete, Key: op.Key})
+					get(append(cp(base), 'a'))
+				}
+			}
+			if !conformance.Check(t, func() trees.IndexTree { return NewArtTree() }, ops) {
+				t.Logf("prefix len: %d, depth: %d", prefixLen, depth)
+			}
+		}
+	}
+
+	// 前缀节点位于 12 深度时，各节点存储的前缀与完整前缀一致
+	tree := NewArtTree()
+	base := []byte("tenant-0001/orders/2024/")
+	tree.Insert([]byte("tenant-0001/x"), 0)
+	tree.Insert(append(cp(base), 'a'), 1)
+	tree.Insert(append(cp(base), 'b'), 2)
+	child := tree.root.findChild('o').asInner()
+	assert.Equal(t, uint32(len(base)-13), child.prefixLen)
+	assert.Equal(t, base[13:13+MAX_PREFIX_LEN], child.prefix[:])
+
+	// 在乐观部分分裂后，新的父子节点分别保存分裂点前后的前缀
+	tree.Insert([]byte("tenant-0001/orders/2025/a"), 3)
+	child = tree.root.findChild('o').asInner()
+	assert.Equal(t, uint32(len("rders/202")), child.prefixLen)
+	assert.Equal(t, []byte("rders/20"), child.prefix[:])
+	grandChild := tree.root.findChild('o').findChild('4').asInner()
+	assert.Equal(t, uint32(1), grandChild.prefixLen)
+	assert.Equal(t, byte('/'), grandChild.prefix[0])
+	for i, k := range []string{"tenant-0001/x", "tenant-0001/orders/2024/a", "tenant-0001/orders/2024/b", "tenant-0001/orders/2025/a"} {
+		assert.Equal(t, i, tree.Search([]byte(k)))
+	}
+}
+
+func TestOptions(t *testing.T) {
+	// 任意配置都需与参考模型一致
+	for name, opts := range map[string][]Option{
+		"prefix=0":     {WithPrefixLen(0)},
+		"prefix=3":     {WithPrefixLen(3)},
+		"hysteresis=1": {WithShrinkHysteresis(1)},
+		"hysteresis=3": {WithShrinkHysteresis(3), WithPrefixLen(5)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			conformance.Run(t, func() trees.IndexTree { return NewArtTree(opts...) })
+		})
+	}
+	assert.Panics(t, func() { WithPrefixLen(MAX_PREFIX_LEN + 1) })
+	assert.Panics(t, func() { WithShrinkHysteresis(-1) })
+
+	// 滞后收缩：在 NODE4/NODE16 边界交替增删不会反复收缩
+	tree := New[int](WithShrinkHysteresis(1))
+	for i := 0; i < MAX_NODE4+1; i++ {
+		tree.Insert([]byte{byte(i)}, i)
+	}
+	assert.Equal(t, NODE16, tree.root.nodeType)
+	tree.Delete([]byte{MAX_NODE4})
+	assert.Equal(t, NODE16, tree.root.nodeType)
+	tree.Delete([]byte{MAX_NODE4 - 1})
+	assert.Equal(t, NODE4, tree.root.nodeType)
+
+	// 零拷贝：叶子节点直接引用写入的 key
+	key := []byte("zero-copy")
+	tree = New[int](WithZeroCopyKeys())
+	tree.Insert(key, 1)
+	tree.Insert([]byte("zero"), 2)
+	k, _ := tree.Max()
+	assert.True(t, &k[0] == &key[0])
+	tree.Insert(nil, 0)
+	k, _ = tree.Min()
+	assert.NotNil(t, k) // 空 key 与查找不到的 nil 区分
+	assert.Empty(t, k)
+	tree = New[int]()
+	tree.Insert(key, 1)
+	k, _ = tree.Min()
+	assert.False(t, &k[0] == &key[0])
+}
+
+//
+// 统计 case
+//
+func TestStats(t *testing.T) {
+	tree := New[int]()
+	for i, k := range []string{"ab", "abc", "abd"} {
+		tree.Insert([]byte(k), i)
+	}
+	s := tree.Stats()
+	assert.Equal(t, s.Keys, 3)
+	assert.Equal(t, s.Nodes, map[string]int{"NODE4": 1, "LEAF": 3})
+	assert.Equal(t, s.Bytes, int(unsafe.Sizeof(node4[int]{})+3*unsafe.Sizeof(leaf[int]{}))+2+3+3)
+	assert.Equal(t, s.Depth, []int{0, 3}) // "ab" 为 NODE4 的 leaf
+	assert.Equal(t, s.Fanout, []int{0, 0, 1})
+	assert.Equal(t, s.PrefixLen, []int{0, 0, 1})
+	assert.Equal(t, s.OptimisticPrefixes, 0)
+
+	// 12 字节的公共前缀超过存储长度
+	for i := 0; i < 256; i++ {
+		tree.Insert(append([]byte("tenant/table"), byte(i)), i)
+	}
+	s = tree.Stats()
+	assert.Equal(t, s.Nodes, map[string]int{"NODE4": 2, "NODE256": 1, "LEAF": 259})
+	assert.Equal(t, s.Fanout[256], 1)
+	assert.Equal(t, s.PrefixLen[len("enant/table")], 1)
+	assert.Equal(t, s.OptimisticPrefixes, 1)
+	assert.Equal(t, New[int]().Stats().Bytes, 0)
+}
+
+//
+// 校验 case
+//
+// 逐一破坏各项不变量，错误中的路径为依次经过的子节点 key
+func TestValidate(t *testing.T) {
+	build := func() *Tree[int] {
+		tree := New[int]()
+		for i := 0; i < 10; i++ {
+			tree.Insert([]byte{'k', byte(i)}, i) // NODE16
+		}
+		for i := 0; i < 30; i++ {
+			tree.Insert([]byte{'n', 0, byte(i)}, i) // NODE48
+		}
+		// NODE4，12 字节的前缀超过存储长度，leaf 恰好在前缀处结束
+		tree.Insert(append([]byte("p"), bytes.Repeat([]byte("q"), 12)...), 0)
+		tree.Insert(append([]byte("p"), bytes.Repeat([]byte("q"), 13)...), 0)
+		assert.Nil(t, tree.Validate())
+		return tree
+	}
+	for _, c := range []struct {
+		name    string
+		corrupt func(tree *Tree[int])
+		path    string
+		reason  string
+	}{
+		{"size", func(tree *Tree[int]) { tree.size++ }, "", "size 43, found 42 leaves"},
+		{"unsorted", func(tree *Tree[int]) {
+			n16 := tree.root.findChild('k').asNode16()
+			n16.keys[0], n16.keys[1] = n16.keys[1], n16.keys[0]
+		}, "k", "NODE16 keys not sorted"},
+		{"nil child", func(tree *Tree[int]) { tree.root.findChild('k').asNode16().size++ }, "k", "NODE16 child 10 is nil"},
+		{"shared slot", func(tree *Tree[int]) {
+			n48 := tree.root.findChild('n').asNode48()
+			n48.keys[1] = n48.keys[0]
+		}, "n", "NODE48 slot 0 is shared"},
+		{"underfull", func(tree *Tree[int]) {
+			tree.root.findChild('p').delete('q')
+			tree.size--
+		}, "p", "NODE4 has 1 entries, below 2"},
+		{"stored prefix", func(tree *Tree[int]) { tree.root.findChild('p').asInner().prefix[3] = 'x' }, "p", `stored prefix "qqqxqqqq"`},
+		{"prefix len", func(tree *Tree[int]) { tree.root.findChild('p').asInner().prefixLen-- }, "p", "does not end at prefix end 12"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			tree := build()
+			c.corrupt(tree)
+			var invalid *trees.InvalidNodeError
+			err := tree.Validate()
+			assert.True(t, errors.As(err, &invalid), "%v", err)
+			assert.Equal(t, string(invalid.Path), c.path)
+			assert.Contains(t, invalid.Reason, c.reason)
+		})
+	}
+}
+
+//
+// 一致性 case
+//
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func() trees.IndexTree { return NewArtTree() })
+}
+
+func FuzzConformance(f *testing.F) {
+	conformance.Fuzz(f, func() trees.IndexTree { return NewArtTree() })
+}
+
+//
+// 不可变 case
+//
+// 每个版本都保持写入时的内容，覆盖分裂、扩容、收缩和 NODE4 合并前缀等路径
+func TestImmutable(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithPrefixLen(2)}, {WithShrinkHysteresis(2)}} {
+		r := rand.New(rand.NewSource(1))
+		cur := NewImmutable[int](opts...)
+		model := map[string]int{}
+		var versions []*Immutable[int]
+		var models []map[string]int
+		for op := 0; op < 5000; op++ {
+			// 短字母表与长公共前缀使节点频繁分裂与合并
+			k := []byte(fmt.Sprintf("key/%s/%d", strings.Repeat("p", r.Intn(12)), r.Intn(300)))
+			if r.Intn(3) == 0 {
+				next, old, ok := cur.Delete(k)
+				want, exists := model[string(k)]
+				assert.Equal(t, ok, exists)
+				assert.Equal(t, old, want)
+				if !ok {
+					assert.True(t, next == cur)
+				}
+				delete(model, string(k))
+				cur = next
+			} else {
+				next, old, replaced := cur.Put(k, op)
+				want, exists := model[string(k)]
+				assert.Equal(t, replaced, exists)
+				assert.Equal(t, old, want)
+				model[string(k)] = op
+				cur = next
+			}
+			if op%50 == 0 {
+				versions = append(versions, cur)
+				models = append(models, maps.Clone(model))
+			}
+		}
+		// Dump 只遍历叶子，还需逐个查找以校验沿途的前缀未被修改
+		for i, v := range versions {
+			assert.Equal(t, v.Dump(), models[i])
+			assert.Equal(t, v.Size(), len(models[i]))
+			assert.Nil(t, v.Validate())
+			for k, want := range models[i] {
+				got, ok := v.Get([]byte(k))
+				assert.True(t, ok)
+				assert.Equal(t, got, want)
+			}
+		}
+	}
+}
+
+// 只拷贝修改路径上的节点，其余子树在新旧版本间共享
+func TestImmutableSharing(t *testing.T) {
+	v1 := NewImmutable[int]()
+	for i := 0; i < 100; i++ {
+		v1 = v1.Insert([]byte(fmt.Sprintf("a%03d", i)), i)
+		v1 = v1.Insert([]byte(fmt.Sprintf("b%03d", i)), i)
+	}
+	v2 := v1.Insert([]byte("a100"), 100)
+	assert.True(t, v1.tree.root != v2.tree.root)
+	assert.True(t, v1.tree.root.findChild('a') != v2.tree.root.findChild('a'))
+	assert.True(t, v1.tree.root.findChild('b') == v2.tree.root.findChild('b'))
+	_, ok := v1.Get([]byte("a100"))
+	assert.False(t, ok)
+
+	// 相同的值依旧生成新版本，PutIfAbsent 已存在则返回原版本
+	v3, _, _ := v2.PutIfAbsent([]byte("a100"), -1)
+	assert.True(t, v3 == v2)
+	v4, old, ok := v2.Delete([]byte("a100"))
+	assert.True(t, ok)
+	assert.Equal(t, old, 100)
+	assert.Equal(t, v4.Dump(), v1.Dump())
+	assert.Equal(t, v2.Search([]byte("a100")), 100)
+}
+
+func TestCOWConformance(t *testing.T) {
+	conformance.Run(t, func() trees.IndexTree { return NewCOWArtTree() })
+}
+
+// 快照在写者持续写入期间保持不变，需配合 go test -race
+func TestSnapshot(t *testing.T) {
+	tree := NewCOWTree[int]()
+	for i := 0; i < 1000; i++ {
+		tree.Insert(binary.BigEndian.AppendUint32(nil, uint32(i)), i)
+	}
+	snap := tree.Snapshot()
+	want := snap.Dump()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5000; i++ {
+			k := binary.BigEndian.AppendUint32(nil, uint32(i%2000))
+			if i%3 == 0 {
+				tree.Delete(k)
+			} else {
+				tree.Insert(k, -i)
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		cnt := 0
+		for k, v := range snap.All() {
+			assert.Equal(t, int(binary.BigEndian.Uint32(k)), v)
+			cnt++
+		}
+		assert.Equal(t, cnt, 1000)
+		tree.Snapshot().Size()
+	}
+	<-done
+	assert.Equal(t, snap.Dump(), want)
+	assert.NotEqual(t, tree.Snapshot().Dump(), want)
+}
+
+//
+// 批量构建 case
+//
+// 与逐个 Insert 得到的树结构相同：节点类型、前缀和子节点逐一对应
+func TestBuildSorted(t *testing.T) {
+	keys := [][]byte{{}, []byte("a"), []byte("ab"), []byte(strings.Repeat("p", 20))}
+	for i := 0; i < 300; i++ {
+		keys = append(keys, []byte{'k', byte(i / 3)}, fmt.Appendf(nil, "user/%s/%d", strings.Repeat("x", i%13), i))
+	}
+	for _, s := range utils.RandStrs(2000, 1, 8) {
+		keys = append(keys, []byte(s))
+	}
+	slices.SortFunc(keys, bytes.Compare)
+	keys = slices.CompactFunc(keys, bytes.Equal)
+
+	for _, opts := range [][]Option{nil, {WithPrefixLen(2)}} {
+		want := New[int](opts...)
+		for i, k := range keys {
+			want.Insert(k, i)
+		}
+		got, err := BuildSorted(func(yield func([]byte, int) bool) {
+			buf := make([]byte, 0, 64)
+			for i, k := range keys {
+				buf = append(buf[:0], k...) // 复用同一块内存，树中必须存拷贝
+				if !yield(buf, i) {
+					return
+				}
+			}
+		}, opts...)
+		assert.Nil(t, err)
+		assert.Equal(t, got.Size(), len(keys))
+		assert.True(t, sameShape(got.root, want.root, got.opts.prefixLen))
+		assert.Nil(t, got.Validate())
+		assert.Equal(t, got.Dump(), want.Dump())
+		for i, k := range keys {
+			assert.Equal(t, got.Search(k), i)
+		}
+	}
+
+	empty, err := BuildSorted[int](func(func([]byte, int) bool) {})
+	assert.Nil(t, err)
+	assert.Equal(t, empty.Size(), 0)
+}
+
+func TestBuildSortedInvalid(t *testing.T) {
+	seq := func(keys ...string) iter.Seq2[[]byte, int] {
+		return func(yield func([]byte, int) bool) {
+			for i, k := range keys {
+				if !yield([]byte(k), i) {
+					return
+				}
+			}
+		}
+	}
+	_, err := BuildSorted(seq("a", "c", "b"))
+	assert.True(t, errors.Is(err, ErrUnsorted))
+	assert.Contains(t, err.Error(), `"b" at 2 follows "c"`)
+	_, err = BuildSorted(seq("a", "b", "b"))
+	assert.True(t, errors.Is(err, ErrDuplicateKey))
+	_, err = BuildSorted(seq("ab", "a"))
+	assert.True(t, errors.Is(err, ErrUnsorted))
+}
+
+func sameShape[V any](a, b *node[V], stored int) bool {
+	if a == nil || b == nil || a.isLeaf() || b.isLeaf() {
+		return a == nil && b == nil || a != nil && b != nil && a.isLeaf() && b.isLeaf() && bytes.Equal(a.asLeaf().key, b.asLeaf().key)
+	}
+	ai, bi := a.asInner(), b.asInner()
+	n := utils.Min(int(ai.prefixLen), stored)
+	if a.nodeType != b.nodeType || ai.size != bi.size || ai.prefixLen != bi.prefixLen ||
+		!bytes.Equal(ai.prefix[:n], bi.prefix[:n]) || !sameShape(ai.leaf, bi.leaf, stored) {
+		return false
+	}
+	for k := 0; k < 256; k++ {
+		if !sameShape(a.findChild(byte(k)), b.findChild(byte(k)), stored) {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// 性能 case
+//
+// 对比 NODE16 的三种查找实现：go test -bench Node16 ./art/
+// 加上 -tags purego 则整棵树使用 SWAR 实现
+func BenchmarkNode16Search(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	var keys [16]byte
+	for i, k := range r.Perm(256)[:16] {
+		keys[i] = byte(k)
+	}
+	sort.Slice(keys[:], func(i, j int) bool { return keys[i] < keys[j] })
+	targets := make([]byte, 1024)
+	for i := range targets {
+		targets[i] = keys[r.Intn(16)] // 均匀命中各个位置
+	}
+
+	for _, bc := range []struct {
+		name string
+		fn   func(keys *[16]byte, k byte, size int) int
+	}{
+		{"linear", linearFindKey16},
+		{"swar", findKey16SWAR},
+		{"default", findKey16},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bc.fn(&keys, targets[i&1023], 16)
+			}
+		})
+	}
+}
+
+// 每层都是满的 NODE16：key 为 4 字节，每个字节取 16 个值之一
+func BenchmarkNode16Tree(b *testing.B) {
+	tree := New[int]()
+	var keys [][]byte
+	for i := 0; i < 1<<16; i++ {
+		key := []byte{byte(i>>12) * 16, byte(i>>8&15) * 16, byte(i>>4&15) * 16, byte(i&15) * 16}
+		keys = append(keys, key)
+		tree.Insert(key, i)
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Get(keys[i&(1<<16-1)])
+	}
+}
+
+// 1M key 下每个 key 占用的堆内存与查找耗时：go test -run XXX -bench Memory -benchtime 1x ./art/
+func BenchmarkMemory(b *testing.B) {
+	const n = 1 << 20
+	r := rand.New(rand.NewSource(1))
+	datasets := []struct {
+		name string
+		keys func() [][]byte
+	}{
+		{"seq", func() [][]byte { // 稠密的 8 字节大端整数
+			keys := make([][]byte, n)
+			for i := range keys {
+				keys[i] = binary.BigEndian.AppendUint64(nil, uint64(i))
+			}
+			return keys
+		}},
+		{"rand", func() [][]byte { // 稀疏的 8 字节随机整数
+			keys := make([][]byte, n)
+			for i := range keys {
+				keys[i] = binary.BigEndian.AppendUint64(nil, r.Uint64())
+			}
+			return keys
+		}},
+		{"str", func() [][]byte { // 5 ~ 15 个小写字母
+			keys := make([][]byte, n)
+			for i, s := range utils.RandStrs(n, 5, 15) {
+				keys[i] = []byte(s)
+			}
+			return keys
+		}},
+	}
+
+	for _, ds := range datasets {
+		b.Run(ds.name, func(b *testing.B) {
+			keys := ds.keys()
+			var before, after runtime.MemStats
+			var tree *Tree[int]
+			for i := 0; i < b.N; i++ {
+				tree = nil
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				tree = New[int]()
+				for j, k := range keys {
+					tree.Insert(k, j)
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+			}
+			b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/float64(tree.Size()), "bytes/key")
+
+			r.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+			start := time.Now()
+			for _, k := range keys {
+				tree.Get(k)
+			}
+			b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(len(keys)), "ns/get")
+		})
+	}
+}
+
+// 存储的前缀长度：key 共享 32 字节的 tenant/table 前缀，miss 在前缀第 4 字节处不同
+// 存储的前缀越长，miss 越早在前缀比较中被拒绝，无需下沉到叶子节点
+func BenchmarkPrefixLen(b *testing.B) {
+	var keys, misses [][]byte
+	for tenant := 0; tenant < 64; tenant++ {
+		for row := 0; row < 1024; row++ {
+			key := fmt.Appendf(nil, "tenant-%04d/table-orders/%016d", tenant, row)
+			keys = append(keys, key)
+			miss := cp(key)
+			miss[3] = 'X'
+			misses = append(misses, miss)
+		}
+	}
+	for _, prefixLen := range []int{0, 4, MAX_PREFIX_LEN} {
+		tree := New[int](WithPrefixLen(prefixLen))
+		for i, k := range keys {
+			tree.Insert(k, i)
+		}
+		b.Run(fmt.Sprintf("prefix=%d/hit", prefixLen), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tree.Get(keys[i%len(keys)])
+			}
+		})
+		b.Run(fmt.Sprintf("prefix=%d/miss", prefixLen), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tree.Get(misses[i%len(misses)])
+			}
+		})
+	}
+}
+
+// 长公共前缀的深树：每层节点的子节点为下一层和 '~' 叶子，最左叶子都在树的最底部；压缩前缀均为 7 字节，悲观模式下完整存储
+// 前缀查找和 Seek 沿最深的 key 下沉，每层比较节点中存储的前缀即可，不应每层都下沉到最左叶子节点
+func BenchmarkDeepPrefix(b *testing.B) {
+	const height, seg = 256, "segment/"
+	tree := New[int]()
+	for d := 0; d <= height; d++ {
+		tree.Insert([]byte(strings.Repeat(seg, d)+"~"), d)
+	}
+	deepest := []byte(strings.Repeat(seg, height))
+	b.Run("HasPrefix", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tree.HasPrefix(deepest)
+		}
+	})
+	b.Run("CountPrefix", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tree.CountPrefix(deepest)
+		}
+	})
+	b.Run("Seek", func(b *testing.B) {
+		it := tree.Iterator()
+		for i := 0; i < b.N; i++ {
+			it.Seek(deepest)
+		}
+	})
+	b.Run("DeletePrefix", func(b *testing.B) {
+		miss := append(cp(deepest), '!') // 不存在的 prefix 同样下沉到最深处，不修改树
+		for i := 0; i < b.N; i++ {
+			tree.DeletePrefix(miss)
+		}
+	})
+}
+
+// 滞后收缩：在 NODE4/NODE16 边界交替增删同一个 key
+func BenchmarkShrinkHysteresis(b *testing.B) {
+	for _, hysteresis := range []int{0, 1} {
+		b.Run(fmt.Sprintf("hysteresis=%d", hysteresis), func(b *testing.B) {
+			tree := New[int](WithShrinkHysteresis(hysteresis))
+			for i := 0; i < MAX_NODE4; i++ {
+				tree.Insert([]byte{byte(i)}, i)
+			}
+			key := []byte{MAX_NODE4}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tree.Insert(key, i)
+				tree.Delete(key)
+			}
+		})
+	}
+}
+
+// 零拷贝：写入新 key 时省去 key 的拷贝
+func BenchmarkZeroCopyKeys(b *testing.B) {
+	keys := make([][]byte, 1<<20)
+	for i := range keys {
+		keys[i] = fmt.Appendf(nil, "tenant-%04d/table-orders/%016d", i%64, i)
+	}
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"copy", nil},
+		{"zero-copy", []Option{WithZeroCopyKeys()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			tree := New[int](bc.opts...)
+			for i := 0; i < b.N; i++ {
+				if i%len(keys) == 0 {
+					tree = New[int](bc.opts...)
+				}
+				tree.Insert(keys[i%len(keys)], i)
+			}
+		})
+	}
+}
+
+// 批量构建与逐个 Insert 对比：go test -run XXX -bench BuildSorted ./art/
+// 稠密整数的节点都会逐级膨胀到 NODE256，字符串的节点较稀疏，主要开销在叶子节点上
+func BenchmarkBuildSorted(b *testing.B) {
+	const n = 1 << 20
+	datasets := []struct {
+		name string
+		keys func() [][]byte
+	}{
+		{"seq", func() [][]byte { // 稠密的 8 字节大端整数
+			keys := make([][]byte, n)
+			for i := range keys {
+				keys[i] = binary.BigEndian.AppendUint64(nil, uint64(i))
+			}
+			return keys
+		}},
+		{"str", func() [][]byte { // 5 ~ 15 个小写字母
+			keys := make([][]byte, n)
+			for i, s := range utils.RandStrs(n, 5, 15) {
+				keys[i] = []byte(s)
+			}
+			slices.SortFunc(keys, bytes.Compare)
+			return slices.CompactFunc(keys, bytes.Equal)
+		}},
+	}
+
+	for _, ds := range datasets {
+		keys := ds.keys()
+		seq := func(yield func([]byte, int) bool) {
+			for i, k := range keys {
+				if !yield(k, i) {
+					return
+				}
+			}
+		}
+		b.Run(ds.name+"/insert", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tree := New[int]()
+				for k, v := range seq {
+					tree.Insert(k, v)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(keys)), "ns/key")
+		})
+		b.Run(ds.name+"/build", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := BuildSorted[int](seq); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(keys)), "ns/key")
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package art
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"iter"
+	"trees/utils"
+)
+
+var (
+	ErrUnsorted     = errors.New("art: keys are not sorted")
+	ErrDuplicateKey = errors.New("art: duplicate key")
+)
+
+// 从升序的 key/value 序列自底向上构建树，比逐个 Insert 省去节点的逐级膨胀和前缀的反复分裂
+// 只保留最右侧路径上尚未完成的节点，子节点收集完毕后一次确定节点类型和压缩前缀，结果与逐个 Insert 得到的树相同
+// key 未严格升序时返回 ErrUnsorted，重复时返回 ErrDuplicateKey，错误中带有出错的位置和 key
+func BuildSorted[V any](seq iter.Seq2[[]byte, V], opts ...Option) (*Tree[V], error) {
+	t := New[V](opts...)
+	b := &builder[V]{tree: t}
+	for k, v := range seq {
+		if t.size > 0 {
+			switch c := bytes.Compare(b.prev, k); {
+			case c == 0:
+				return nil, fmt.Errorf("%w: %q at %d", ErrDuplicateKey, k, t.size)
+			case c > 0:
+				return nil, fmt.Errorf("%w: %q at %d follows %q", ErrUnsorted, k, t.size, b.prev)
+			}
+			b.add(k)
+		}
+		b.cur = t.newLeaf(k, v)
+		b.prev = b.cur.asLeaf().key // 调用方可能复用 k 的内存，之后与拷贝后的 key 比较
+		t.size++
+	}
+	for len(b.stack) > 0 {
+		b.pop()
+	}
+	if b.cur != nil {
+		b.setPrefix(0)
+		t.root = b.cur
+	}
+	return t, nil
+}
+
+// 最右侧路径上尚未完成的内部节点
+type buildFrame[V any] struct {
+	depth  int // 子节点 key 的下标，即前缀结束的位置
+	leaf   *node[V]
+	keys   []byte // 升序收集的子节点
+	childs []*node[V]
+}
+
+type builder[V any] struct {
+	tree  *Tree[V]
+	stack []buildFrame[V] // 自 root 向下，depth 严格递增
+	cur   *node[V]        // 包含 prev 的最右侧子树，已完成但还未挂到栈顶节点
+	depth int             // cur 为内部节点时的 depth
+	prev  []byte          // 目前最大的 key
+}
+
+// 新 key 与 prev 在 depth 更深处分叉的节点都不会再有新的子节点，逐个完成后挂到分叉点的节点上
+func (b *builder[V]) add(key []byte) {
+	commonLen := utils.LongestPrefix(b.prev, key)
+	for len(b.stack) > 0 && b.stack[len(b.stack)-1].depth > commonLen {
+		b.pop()
+	}
+	if len(b.stack) == 0 || b.stack[len(b.stack)-1].depth < commonLen {
+		b.push(commonLen)
+	}
+	b.attach()
+}
+
+// 复用栈中已分配的 frame 及其子节点数组
+func (b *builder[V]) push(depth int) {
+	if len(b.stack) == cap(b.stack) {
+		b.stack = append(b.stack, buildFrame[V]{})
+	} else {
+		b.stack = b.stack[:len(b.stack)+1]
+	}
+	f := &b.stack[len(b.stack)-1]
+	f.depth, f.leaf = depth, nil
+	f.keys, f.childs = f.keys[:0], f.childs[:0]
+}
+
+// 将 cur 挂到栈顶节点，恰好在其前缀处结束的 key 存为 leaf
+func (b *builder[V]) attach() {
+	f := &b.stack[len(b.stack)-1]
+	b.setPrefix(f.depth + 1)
+	if len(b.prev) == f.depth {
+		f.leaf = b.cur
+		return
+	}
+	f.keys = append(f.keys, b.prev[f.depth])
+	f.childs = append(f.childs, b.cur)
+}
+
+// 完成栈顶节点，子节点数决定节点类型，完成的节点成为新的 cur
+func (b *builder[V]) pop() {
+	b.attach()
+	f := &b.stack[len(b.stack)-1]
+	var n *node[V]
+	switch size := len(f.keys); {
+	case size <= MAX_NODE4:
+		n = &newNode4[V]().node
+	case size <= MAX_NODE16:
+		n = &newNode16[V]().node
+	case size <= MAX_NODE48:
+		n = &newNode48[V]().node
+	default:
+		n = &newNode256[V]().node
+	}
+	n.asInner().leaf = f.leaf
+	for i, k := range f.keys {
+		n.addChild(&n, k, f.childs[i]) // 按升序追加，节点不会满
+	}
+	clear(f.childs) // 复用时不再引用已完成的节点
+	b.cur, b.depth = n, f.depth
+	b.stack = b.stack[:len(b.stack)-1]
+}
+
+// cur 为内部节点时，父节点确定后其前缀为 prev[start:depth]
+func (b *builder[V]) setPrefix(start int) {
+	if b.cur.isLeaf() {
+		return
+	}
+	in := b.cur.asInner()
+	in.prefixLen = uint32(b.depth - start)
+	utils.Memcpy(in.prefix[:], b.prev[start:b.depth], utils.Min(int(in.prefixLen), b.tree.opts.prefixLen))
+}
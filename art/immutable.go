@@ -0,0 +1,368 @@
+package art
+
+import (
+	"iter"
+	"sync"
+	"sync/atomic"
+	"trees"
+	"trees/utils"
+)
+
+// 不可变的自适应基数树，即持久化数据结构
+// Put / Delete 不修改当前版本，而是从 root 开始拷贝到目标 key 路径上的节点，返回新版本
+// 新旧版本共享未修改的子树，旧版本始终有效，可以被任意多个 goroutine 并发读取
+type Immutable[V any] struct {
+	tree Tree[V] // 只读，所有读操作复用 Tree 的实现
+}
+
+// 创建空的不可变树
+func NewImmutable[V any](opts ...Option) *Immutable[V] {
+	return &Immutable[V]{tree: *New[V](opts...)}
+}
+
+func (t *Immutable[V]) with(root *node[V], size int) *Immutable[V] {
+	return &Immutable[V]{tree: Tree[V]{root: root, size: size, opts: t.tree.opts}}
+}
+
+// 新增或更新，返回新版本
+func (t *Immutable[V]) Insert(key []byte, val V) *Immutable[V] {
+	next, _, _ := t.Put(key, val)
+	return next
+}
+
+// 新增或更新，返回新版本，replaced 标识 key 是否已存在，old 为被覆盖的旧值
+func (t *Immutable[V]) Put(key []byte, val V) (next *Immutable[V], old V, replaced bool) {
+	return t.insert(key, val, true)
+}
+
+// 仅在 key 不存在时写入，key 已存在则返回当前版本本身，existing 为已存在的值
+func (t *Immutable[V]) PutIfAbsent(key []byte, val V) (next *Immutable[V], existing V, loaded bool) {
+	return t.insert(key, val, false)
+}
+
+func (t *Immutable[V]) insert(key []byte, val V, overwrite bool) (next *Immutable[V], old V, ok bool) {
+	root, old, ok := t.insertCopy(t.tree.root, 0, key, val, overwrite)
+	if root == t.tree.root {
+		return t, old, ok
+	}
+	size := t.tree.size
+	if !ok {
+		size++
+	}
+	return t.with(root, size), old, ok
+}
+
+// 删除 key，返回新版本，key 不存在则返回当前版本本身
+func (t *Immutable[V]) Delete(key []byte) (next *Immutable[V], old V, ok bool) {
+	root, old, ok := t.deleteCopy(t.tree.root, 0, key)
+	if !ok {
+		return t, old, false
+	}
+	return t.with(root, t.tree.size-1), old, true
+}
+
+// 路径拷贝版本的 Tree.insert，返回替换 n 的新节点，未修改时返回 n 本身
+// 只修改本次拷贝或新建的节点，原版本的节点保持不变
+func (t *Immutable[V]) insertCopy(n *node[V], depth int, key []byte, val V, overwrite bool) (next *node[V], old V, ok bool) {
+	// 1. 空树或空叶子节点
+	if n == nil {
+		return t.tree.newLeaf(key, val), old, false
+	}
+
+	// 2. 叶子节点：key 存在则替换为新叶子，否则与新叶子一起挂到公共前缀节点下
+	if n.isLeaf() {
+		l := n.asLeaf()
+		if l.isMatch(key) {
+			if !overwrite {
+				return n, l.val, true
+			}
+			return newLeaf(l.key, val), l.val, true // 叶子的 key 不会被修改，可以共享
+		}
+		leaf := t.tree.newLeaf(key, val)
+		commonLen := l.matchPrefixLen(leaf.asLeaf(), depth)
+		parent := newNode4[V]()
+		parent.prefixLen = uint32(commonLen)
+		utils.Memcpy(parent.prefix[:], key[depth:depth+commonLen], utils.Min(commonLen, t.tree.opts.prefixLen))
+		next = &parent.node
+		parent.addLeaf(&next, depth+commonLen, n)
+		parent.addLeaf(&next, depth+commonLen, leaf)
+		return next, old, false
+	}
+
+	// 3. 内部节点分裂：n 的前缀被截短，需拷贝一份再挂到新的父节点下
+	in := n.asInner()
+	diffIdx := in.mismatchPrefixLen(key, depth, t.tree.opts.prefixLen)
+	if diffIdx != int(in.prefixLen) {
+		fullPrefix := in.prefix[:]
+		if int(in.prefixLen) > t.tree.opts.prefixLen {
+			fullPrefix = n.minChild().key[depth : depth+int(in.prefixLen)]
+		}
+		parent := newNode4[V]()
+		parent.prefixLen = uint32(diffIdx)
+		copy(parent.prefix[:], fullPrefix[:diffIdx])
+		next = &parent.node
+		parent.addLeaf(&next, depth+diffIdx, t.tree.newLeaf(key, val))
+
+		cur := n.clone()
+		ci := cur.asInner()
+		ci.prefixLen -= uint32(diffIdx + 1)
+		copy(ci.prefix[:], fullPrefix[diffIdx+1:])
+		parent.addChild(&next, fullPrefix[diffIdx], cur)
+		return next, old, false
+	}
+
+	// 4. key 恰好在当前节点的前缀处结束
+	depth += int(in.prefixLen)
+	if depth == len(key) {
+		leaf, old, ok := t.insertCopy(in.leaf, depth, key, val, overwrite)
+		if leaf == in.leaf {
+			return n, old, ok
+		}
+		next = n.clone()
+		next.asInner().leaf = leaf
+		return next, old, ok
+	}
+
+	// 5. 子节点不存在则添加叶子，已满时 grow 本身就返回新节点，无需再拷贝
+	child := n.findChild(key[depth])
+	if child == nil {
+		if n.isFull() {
+			next = n.grow()
+		} else {
+			next = n.clone()
+		}
+		next.addChild(&next, key[depth], t.tree.newLeaf(key, val))
+		return next, old, false
+	}
+
+	// 6. 下沉，子树有变化时才拷贝当前节点
+	newChild, old, ok := t.insertCopy(child, depth+1, key, val, overwrite)
+	if newChild == child {
+		return n, old, ok
+	}
+	next = n.clone()
+	*next.key2childRef(key[depth]) = newChild
+	return next, old, ok
+}
+
+// 路径拷贝版本的 Tree.delete，返回替换 n 的新节点，子树被删空时返回 nil
+func (t *Immutable[V]) deleteCopy(n *node[V], depth int, key []byte) (next *node[V], old V, ok bool) {
+	if n == nil {
+		return nil, old, false
+	}
+	if n.isLeaf() {
+		if l := n.asLeaf(); l.isMatch(key) {
+			return nil, l.val, true
+		}
+		return n, old, false
+	}
+
+	in := n.asInner()
+	if !in.checkPrefix(key, depth, t.tree.opts.prefixLen) {
+		return n, old, false
+	}
+	depth += int(in.prefixLen)
+	if depth == len(key) {
+		if in.leaf == nil || !in.leaf.asLeaf().isMatch(key) {
+			return n, old, false
+		}
+		next = n.clone()
+		next.asInner().leaf = nil
+		return t.shrink(next), in.leaf.asLeaf().val, true
+	}
+
+	child := n.findChild(key[depth])
+	if child == nil {
+		return n, old, false
+	}
+	newChild, old, ok := t.deleteCopy(child, depth+1, key)
+	if !ok {
+		return n, old, false
+	}
+	next = n.clone()
+	if newChild == nil {
+		next.delete(key[depth])
+	} else {
+		*next.key2childRef(key[depth]) = newChild
+	}
+	return t.shrink(next), old, true
+}
+
+// 删除后逐级收缩，n 为本次拷贝出的节点，可以原地修改
+// NODE4 合并时会把前缀写入唯一的子节点，该子节点与旧版本共享，需先拷贝
+func (t *Immutable[V]) shrink(n *node[V]) *node[V] {
+	for n.isEmpty(t.tree.opts.shrinkHysteresis) {
+		if n4 := n.asNode4(); n.nodeType == NODE4 && n4.leaf == nil && n4.size == 1 && !n4.childs[0].isLeaf() {
+			n4.childs[0] = n4.childs[0].clone()
+		}
+		next := n.shrink(t.tree.opts.prefixLen)
+		if next == n {
+			break
+		}
+		if n = next; n.isLeaf() {
+			break
+		}
+	}
+	return n
+}
+
+// 只读操作，与 Tree 的语义相同
+
+func (t *Immutable[V]) Get(key []byte) (v V, ok bool)      { return t.tree.Get(key) }
+func (t *Immutable[V]) Search(key []byte) V                { return t.tree.Search(key) }
+func (t *Immutable[V]) Size() int                          { return t.tree.Size() }
+func (t *Immutable[V]) Dump() map[string]V                 { return t.tree.Dump() }
+func (t *Immutable[V]) Min() (k []byte, v V)               { return t.tree.Min() }
+func (t *Immutable[V]) Max() (k []byte, v V)               { return t.tree.Max() }
+func (t *Immutable[V]) Floor(key []byte) (k []byte, v V)   { return t.tree.Floor(key) }
+func (t *Immutable[V]) Ceiling(key []byte) (k []byte, v V) { return t.tree.Ceiling(key) }
+func (t *Immutable[V]) Lower(key []byte) (k []byte, v V)   { return t.tree.Lower(key) }
+func (t *Immutable[V]) Higher(key []byte) (k []byte, v V)  { return t.tree.Higher(key) }
+func (t *Immutable[V]) HasPrefix(prefix []byte) bool       { return t.tree.HasPrefix(prefix) }
+func (t *Immutable[V]) CountPrefix(prefix []byte) int      { return t.tree.CountPrefix(prefix) }
+func (t *Immutable[V]) Iterator() trees.Cursor[V]          { return t.tree.Iterator() }
+func (t *Immutable[V]) All() iter.Seq2[[]byte, V]          { return t.tree.All() }
+func (t *Immutable[V]) Validate() error                    { return t.tree.Validate() }
+func (t *Immutable[V]) Stats() trees.Stats                 { return t.tree.Stats() }
+func (t *Immutable[V]) Backward() iter.Seq2[[]byte, V]     { return t.tree.Backward() }
+
+func (t *Immutable[V]) LongestPrefix(key []byte) (k []byte, v V, ok bool) {
+	return t.tree.LongestPrefix(key)
+}
+
+func (t *Immutable[V]) Range(start, end []byte, fn func(k []byte, v V) bool) {
+	t.tree.Range(start, end, fn)
+}
+
+func (t *Immutable[V]) WalkPrefix(prefix []byte, fn func(k []byte, v V) bool) {
+	t.tree.WalkPrefix(prefix, fn)
+}
+
+// 拷贝节点本身，子节点与原节点共享
+func (n *node[V]) clone() *node[V] {
+	switch n.nodeType {
+	case NODE4:
+		c := *n.asNode4()
+		return &c.node
+	case NODE16:
+		c := *n.asNode16()
+		return &c.node
+	case NODE48:
+		c := *n.asNode48()
+		return &c.node
+	case NODE256:
+		c := *n.asNode256()
+		return &c.node
+	}
+	c := *n.asLeaf()
+	return &c.node
+}
+
+var _ trees.Tree[int] = (*COWTree[int])(nil)
+
+// 写时拷贝的可变树，实现 trees.Tree 接口
+// 每次写入都在当前版本上路径拷贝出新版本再原子地替换，写者之间串行，读者和快照不加锁
+// Snapshot 以 O(1) 返回当前版本，之后的写入对其不可见，长时间运行的读者和备份可以与写者同时进行
+type COWTree[V any] struct {
+	mu  sync.Mutex
+	cur atomic.Pointer[Immutable[V]]
+}
+
+// 兼容存储 interface{} 的旧版 API
+type COWArtTree = COWTree[interface{}]
+
+func NewCOWTree[V any](opts ...Option) *COWTree[V] {
+	t := &COWTree[V]{}
+	t.cur.Store(NewImmutable[V](opts...))
+	return t
+}
+
+func NewCOWArtTree(opts ...Option) *COWArtTree {
+	return NewCOWTree[interface{}](opts...)
+}
+
+// 当前版本的只读快照
+func (t *COWTree[V]) Snapshot() *Immutable[V] {
+	return t.cur.Load()
+}
+
+func (t *COWTree[V]) Insert(key []byte, val V) {
+	t.Put(key, val)
+}
+
+func (t *COWTree[V]) Put(key []byte, val V) (old V, replaced bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	next, old, replaced := t.cur.Load().Put(key, val)
+	t.cur.Store(next)
+	return old, replaced
+}
+
+func (t *COWTree[V]) PutIfAbsent(key []byte, val V) (existing V, loaded bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	next, existing, loaded := t.cur.Load().PutIfAbsent(key, val)
+	t.cur.Store(next)
+	return existing, loaded
+}
+
+func (t *COWTree[V]) Delete(key []byte) (old V, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	next, old, ok := t.cur.Load().Delete(key)
+	t.cur.Store(next)
+	return old, ok
+}
+
+func (t *COWTree[V]) PopMin() (k []byte, v V) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cur := t.cur.Load()
+	if k, v = cur.Min(); k != nil {
+		next, _, _ := cur.Delete(k)
+		t.cur.Store(next)
+	}
+	return k, v
+}
+
+func (t *COWTree[V]) PopMax() (k []byte, v V) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cur := t.cur.Load()
+	if k, v = cur.Max(); k != nil {
+		next, _, _ := cur.Delete(k)
+		t.cur.Store(next)
+	}
+	return k, v
+}
+
+// 只读操作在调用时刻的版本上进行，迭代期间的写入不可见
+
+func (t *COWTree[V]) Get(key []byte) (v V, ok bool)      { return t.Snapshot().Get(key) }
+func (t *COWTree[V]) Search(key []byte) V                { return t.Snapshot().Search(key) }
+func (t *COWTree[V]) Size() int                          { return t.Snapshot().Size() }
+func (t *COWTree[V]) Dump() map[string]V                 { return t.Snapshot().Dump() }
+func (t *COWTree[V]) Min() (k []byte, v V)               { return t.Snapshot().Min() }
+func (t *COWTree[V]) Max() (k []byte, v V)               { return t.Snapshot().Max() }
+func (t *COWTree[V]) Floor(key []byte) (k []byte, v V)   { return t.Snapshot().Floor(key) }
+func (t *COWTree[V]) Ceiling(key []byte) (k []byte, v V) { return t.Snapshot().Ceiling(key) }
+func (t *COWTree[V]) Lower(key []byte) (k []byte, v V)   { return t.Snapshot().Lower(key) }
+func (t *COWTree[V]) Higher(key []byte) (k []byte, v V)  { return t.Snapshot().Higher(key) }
+func (t *COWTree[V]) HasPrefix(prefix []byte) bool       { return t.Snapshot().HasPrefix(prefix) }
+func (t *COWTree[V]) CountPrefix(prefix []byte) int      { return t.Snapshot().CountPrefix(prefix) }
+func (t *COWTree[V]) Iterator() trees.Cursor[V]          { return t.Snapshot().Iterator() }
+func (t *COWTree[V]) All() iter.Seq2[[]byte, V]          { return t.Snapshot().All() }
+func (t *COWTree[V]) Validate() error                    { return t.Snapshot().Validate() }
+func (t *COWTree[V]) Backward() iter.Seq2[[]byte, V]     { return t.Snapshot().Backward() }
+
+func (t *COWTree[V]) LongestPrefix(key []byte) (k []byte, v V, ok bool) {
+	return t.Snapshot().LongestPrefix(key)
+}
+
+func (t *COWTree[V]) Range(start, end []byte, fn func(k []byte, v V) bool) {
+	t.Snapshot().Range(start, end, fn)
+}
+
+func (t *COWTree[V]) WalkPrefix(prefix []byte, fn func(k []byte, v V) bool) {
+	t.Snapshot().WalkPrefix(prefix, fn)
+}
@@ -0,0 +1,220 @@
+package art
+
+import (
+	"bytes"
+	"iter"
+	"trees"
+	"trees/utils"
+)
+
+var _ trees.Tree[int] = (*Tree[int])(nil)
+var _ trees.IndexTree = (*ArtTree)(nil)
+
+// 游标下沉路径上的内部节点，pos 为当前所在子节点的 key，-1 表示位于节点自身的 leaf
+type frame[V any] struct {
+	n   *node[V]
+	pos int
+}
+
+// 有序双向迭代器
+// stack 记录从 root 到当前叶子节点的父节点路径，Next / Prev 回溯到最近的兄弟节点后再下沉
+type Iterator[V any] struct {
+	tree  *Tree[V]
+	stack []frame[V]
+	leaf  *leaf[V]
+}
+
+func (t *Tree[V]) Iterator() trees.Cursor[V] {
+	return &Iterator[V]{tree: t}
+}
+
+// 升序遍历
+func (t *Tree[V]) All() iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		it := &Iterator[V]{tree: t}
+		for ok := it.SeekToFirst(); ok; ok = it.Next() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// 降序遍历
+func (t *Tree[V]) Backward() iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		it := &Iterator[V]{tree: t}
+		for ok := it.SeekToLast(); ok; ok = it.Prev() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+func (it *Iterator[V]) reset() {
+	it.stack = it.stack[:0]
+	it.leaf = nil
+}
+
+func (it *Iterator[V]) SeekToFirst() bool {
+	it.reset()
+	return it.first(it.tree.root)
+}
+
+func (it *Iterator[V]) SeekToLast() bool {
+	it.reset()
+	return it.last(it.tree.root)
+}
+
+// 定位到第一个 >= key 的叶子节点
+// 沿 key 下沉，在前缀或子节点 key 出现分歧时，根据大小决定取当前子树的最小叶子，或回溯取下一个兄弟子树
+func (it *Iterator[V]) Seek(key []byte) bool {
+	it.reset()
+	n := it.tree.root
+	depth := 0
+	for n != nil {
+		if n.isLeaf() {
+			if l := n.asLeaf(); bytes.Compare(l.key, key) >= 0 {
+				it.leaf = l
+				return true
+			}
+			return it.next()
+		}
+
+		prefixLen := int(n.asInner().prefixLen)
+		prefix := it.tree.fullPrefix(n, depth)
+		end := utils.Min(len(key), depth+prefixLen)
+		switch c := bytes.Compare(key[depth:end], prefix[:end-depth]); {
+		case c < 0:
+			return it.first(n) // 整棵子树都大于 key
+		case c > 0:
+			return it.next() // 整棵子树都小于 key
+		}
+		depth += prefixLen
+		if depth >= len(key) {
+			return it.first(n) // n.leaf 恰好等于 key，其余子节点都大于 key
+		}
+
+		k := int(key[depth])
+		it.stack = append(it.stack, frame[V]{n: n, pos: k})
+		if child := n.findChild(key[depth]); child != nil {
+			n = child
+			depth++
+			continue
+		}
+		return it.next() // k 对应的子节点不存在，取其后第一个兄弟子树
+	}
+	return false
+}
+
+// 定位到最后一个 <= key 的叶子节点
+func (it *Iterator[V]) SeekForPrev(key []byte) bool {
+	if !it.Seek(key) {
+		return it.SeekToLast()
+	}
+	if bytes.Equal(it.leaf.key, key) {
+		return true
+	}
+	return it.Prev()
+}
+
+func (it *Iterator[V]) Next() bool {
+	if !it.Valid() {
+		return false
+	}
+	return it.next()
+}
+
+func (it *Iterator[V]) Prev() bool {
+	if !it.Valid() {
+		return false
+	}
+	return it.prev()
+}
+
+func (it *Iterator[V]) Valid() bool {
+	return it.leaf != nil
+}
+
+func (it *Iterator[V]) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.leaf.key
+}
+
+func (it *Iterator[V]) Value() (v V) {
+	if !it.Valid() {
+		return v
+	}
+	return it.leaf.val
+}
+
+// 从 n 一路向左下沉到最小叶子节点
+func (it *Iterator[V]) first(n *node[V]) bool {
+	for n != nil && !n.isLeaf() {
+		if l := n.asInner().leaf; l != nil {
+			it.stack = append(it.stack, frame[V]{n: n, pos: -1})
+			n = l
+			continue
+		}
+		k, child := n.childGE(0)
+		it.stack = append(it.stack, frame[V]{n: n, pos: k})
+		n = child
+	}
+	return it.setLeaf(n)
+}
+
+// 从 n 一路向右下沉到最大叶子节点
+func (it *Iterator[V]) last(n *node[V]) bool {
+	for n != nil && !n.isLeaf() {
+		k, child := n.childLE(255)
+		if child == nil {
+			k, child = -1, n.asInner().leaf // 没有子节点时只剩 leaf
+		}
+		it.stack = append(it.stack, frame[V]{n: n, pos: k})
+		n = child
+	}
+	return it.setLeaf(n)
+}
+
+func (it *Iterator[V]) setLeaf(n *node[V]) bool {
+	it.leaf = nil
+	if n != nil {
+		it.leaf = n.asLeaf()
+	}
+	return it.leaf != nil
+}
+
+// 回溯到第一个存在右兄弟的父节点，再取右兄弟子树的最小叶子
+func (it *Iterator[V]) next() bool {
+	for len(it.stack) > 0 {
+		top := &it.stack[len(it.stack)-1]
+		if k, child := top.n.childGE(top.pos + 1); child != nil {
+			top.pos = k
+			return it.first(child)
+		}
+		it.stack = it.stack[:len(it.stack)-1]
+	}
+	it.leaf = nil
+	return false
+}
+
+// 回溯到第一个存在左兄弟或 leaf 的父节点，再取左兄弟子树的最大叶子或该 leaf
+func (it *Iterator[V]) prev() bool {
+	for len(it.stack) > 0 {
+		top := &it.stack[len(it.stack)-1]
+		if k, child := top.n.childLE(top.pos - 1); child != nil {
+			top.pos = k
+			return it.last(child)
+		}
+		if l := top.n.asInner().leaf; top.pos >= 0 && l != nil {
+			top.pos = -1
+			return it.setLeaf(l)
+		}
+		it.stack = it.stack[:len(it.stack)-1]
+	}
+	it.leaf = nil
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"trees/utils"
+	"unsafe"
 )
 
 type nodeType uint8
@@ -16,6 +17,23 @@ const (
 	LEAF
 )
 
+func (t nodeType) String() string {
+	switch t {
+	case NODE4:
+		return "NODE4"
+	case NODE16:
+		return "NODE16"
+	case NODE48:
+		return "NODE48"
+	case NODE256:
+		return "NODE256"
+	case LEAF:
+		return "LEAF"
+	}
+	return fmt.Sprintf("nodeType(%d)", t)
+}
+
+// 收缩下限恰好比下一级节点的膨胀上限多 1，收缩后的节点总能放下剩余的子节点
 const (
 	MIN_NODE4 = 2 // 节点收缩下限
 	MAX_NODE4 = 4 // 节点膨胀上限
@@ -27,12 +45,12 @@ const (
 	MAX_NODE48 = 48
 
 	MIN_NODE256 = 49
-	MAX_NODE256 = 255
+	MAX_NODE256 = 256 // 每个字节都有独立的槽位，永远不会满
 
-	MAX_PREFIX_LEN = 8 // 当前缀超过 8 bytes 则从悲观模式切换到乐观模式
+	MAX_PREFIX_LEN = 8 // 节点中最多存储 8 bytes 前缀，超过存储长度则从悲观模式切换到乐观模式，见 WithPrefixLen
 )
 
-func (n *node) maxSize() (size int) {
+func (n *node[V]) maxSize() (size int) {
 	switch n.nodeType {
 	case NODE4:
 		size = MAX_NODE4
@@ -46,7 +64,7 @@ func (n *node) maxSize() (size int) {
 	return size
 }
 
-func (n *node) minSize() (size int) {
+func (n *node[V]) minSize() (size int) {
 	switch n.nodeType {
 	case NODE4:
 		size = MIN_NODE4
@@ -60,132 +78,193 @@ func (n *node) minSize() (size int) {
 	return size
 }
 
-type node struct {
-	size     int // node 的其他字段均为预分配，其长度不能作为子节点数量
+// 所有节点的公共头部
+// 各类节点都以头部作为第一个字段，树中只保存头部指针，再根据 nodeType 转换为具体类型的节点
+type node[V any] struct {
 	nodeType nodeType
+}
+
+// 内部节点的公共部分，各字段紧凑排列，共 24 bytes
+type inner[V any] struct {
+	node[V]
+	size      uint16               // 子节点数量，NODE256 最多有 256 个
+	prefixLen uint32               // 乐观模式，记录完整的前缀长度，比较时找到叶子节点才回溯比较
+	prefix    [MAX_PREFIX_LEN]byte // 悲观模式，为了节省空间，实际只存储一部分公共前缀
+	leaf      *node[V]             // 恰好在前缀处结束的 key，是所有子节点 key 的前缀
+}
 
-	// internal node
-	keys      []byte  // 有序的子节点 key
-	childs    []*node // 指向子节点的指针
-	prefix    []byte  // 悲观模式, 为了节省空间，实际只存储一部分公共前缀，最长为 MAX_PREFIX_LEN
-	prefixLen int     // 乐观模式，记录完整的前缀长度，比较时找到叶子节点才回溯比较
+type node4[V any] struct {
+	inner[V]
+	keys   [MAX_NODE4]byte // 有序的子节点 key
+	childs [MAX_NODE4]*node[V]
+}
 
-	// leaf node
+type node16[V any] struct {
+	inner[V]
+	keys   [MAX_NODE16]byte // 有序的子节点 key
+	childs [MAX_NODE16]*node[V]
+}
+
+type node48[V any] struct {
+	inner[V]
+	keys   [256]byte // 以 key 为下标，存储 childs 的索引 +1，0 表示子节点不存在
+	childs [MAX_NODE48]*node[V]
+}
+
+type node256[V any] struct {
+	inner[V]
+	childs [MAX_NODE256]*node[V] // 以 key 为下标
+}
+
+type leaf[V any] struct {
+	node[V]
 	key []byte
-	val interface{}
+	val V
 }
 
-func newLeaf(key []byte, val interface{}) *node {
-	newKey := make([]byte, len(key))
-	copy(newKey, key)
-	return &node{
-		nodeType: LEAF,
-		key:      newKey,
-		val:      val,
-	}
+// 叶子节点直接持有 key，是否拷贝由调用方决定
+func newLeaf[V any](key []byte, val V) *node[V] {
+	l := &leaf[V]{key: key, val: val}
+	l.nodeType = LEAF
+	return &l.node
 }
 
-func newNode4() *node {
-	return &node{
-		nodeType: NODE4,
-		keys:     make([]byte, MAX_NODE4),
-		childs:   make([]*node, MAX_NODE4),
-		prefix:   make([]byte, MAX_PREFIX_LEN),
-	}
+func newNode4[V any]() *node4[V] {
+	n := &node4[V]{}
+	n.nodeType = NODE4
+	return n
 }
 
-func newNode16() *node {
-	return &node{
-		nodeType: NODE16,
-		keys:     make([]byte, MAX_NODE16),
-		childs:   make([]*node, MAX_NODE16),
-		prefix:   make([]byte, MAX_PREFIX_LEN),
-	}
+func newNode16[V any]() *node16[V] {
+	n := &node16[V]{}
+	n.nodeType = NODE16
+	return n
 }
 
-func newNode48() *node {
-	return &node{
-		nodeType: NODE48,
-		keys:     make([]byte, MAX_NODE256), // node48 的 keys 有 256 bytes，查找和空间的折中
-		childs:   make([]*node, MAX_NODE48),
-		prefix:   make([]byte, MAX_PREFIX_LEN),
-	}
+func newNode48[V any]() *node48[V] {
+	n := &node48[V]{}
+	n.nodeType = NODE48
+	return n
 }
 
-func newNode256() *node {
-	return &node{
-		nodeType: NODE256,
-		keys:     nil,
-		childs:   make([]*node, MAX_NODE256),
-		prefix:   make([]byte, MAX_NODE256),
-	}
+func newNode256[V any]() *node256[V] {
+	n := &node256[V]{}
+	n.nodeType = NODE256
+	return n
 }
 
-func (n *node) isLeaf() bool {
+// 头部指针转换为具体类型的节点，调用方需保证 nodeType 匹配
+func (n *node[V]) asLeaf() *leaf[V]       { return (*leaf[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asInner() *inner[V]     { return (*inner[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asNode4() *node4[V]     { return (*node4[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asNode16() *node16[V]   { return (*node16[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asNode48() *node48[V]   { return (*node48[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asNode256() *node256[V] { return (*node256[V])(unsafe.Pointer(n)) }
+
+func (n *node[V]) isLeaf() bool {
 	return n.nodeType == LEAF
 }
 
 // 检查 key 和当前叶子节点的完整 key 是否完全一致
-func (n *node) isMatch(key []byte) bool {
-	if !n.isLeaf() {
-		return false
-	}
-	return bytes.Compare(n.key, key) == 0
+func (l *leaf[V]) isMatch(key []byte) bool {
+	return bytes.Equal(l.key, key)
 }
 
-func (n *node) isFull() bool {
-	return n.size >= n.maxSize() // 已达到最大容量，需要先膨胀
+func (n *node[V]) isFull() bool {
+	return int(n.asInner().size) >= n.maxSize() // 已达到最大容量，需要先膨胀
 }
 
-func (n *node) isEmpty() bool {
-	return n.size < n.minSize()
+// NODE4 以外的节点按 hysteresis 延后收缩
+func (n *node[V]) isEmpty(hysteresis int) bool {
+	min := n.minSize()
+	if n.nodeType != NODE4 {
+		min -= hysteresis
+	}
+	return int(n.asInner().size) < min
 }
 
-//
 // utils
 //
 // 从旧节点拷贝元信息
-func (n *node) copyMeta(old *node) {
+func (n *inner[V]) copyMeta(old *inner[V]) {
 	n.size = old.size
 	n.prefix = old.prefix
 	n.prefixLen = old.prefixLen
+	n.leaf = old.leaf
 }
 
-// 映射 key 到 child
-func (n *node) key2childRef(k byte) **node {
-	var emptyNode *node = nil
+// NODE4 和 NODE16 的 keys 与 childs 数组，二者的子节点均按 key 有序存放
+func (n *node[V]) sortedChilds() (keys []byte, childs []*node[V]) {
+	switch n.nodeType {
+	case NODE4:
+		n4 := n.asNode4()
+		return n4.keys[:], n4.childs[:]
+	case NODE16:
+		n16 := n.asNode16()
+		return n16.keys[:], n16.childs[:]
+	}
+	panic(fmt.Sprintf("unsorted node type: %d", n.nodeType))
+}
+
+// 映射 key 到 child 的槽位，子节点不存在则返回 nil
+// 需返回槽位本身的地址，下沉时才能原地替换子节点
+func (n *node[V]) key2childRef(k byte) **node[V] {
 	if n == nil {
-		return &emptyNode
+		return nil
+	}
+	i := n.key2childIndex(k)
+	if i == -1 {
+		return nil
 	}
 	switch n.nodeType {
-	case NODE4, NODE16, NODE48:
-		i := n.key2childIndex(k)
-		if i == -1 {
-			return &emptyNode
-		}
-		return &n.childs[i]
+	case NODE4, NODE16:
+		_, childs := n.sortedChilds()
+		return &childs[i]
+	case NODE48:
+		return &n.asNode48().childs[i]
 	case NODE256:
-		directChild := n.childs[k]
-		if directChild == nil {
-			return &emptyNode
+		if ref := &n.asNode256().childs[i]; *ref != nil {
+			return ref
 		}
-		return &directChild
 	}
-	return &emptyNode
+	return nil
+}
+
+// 映射 key 到 child，只读路径使用，不存在则返回 nil
+func (n *node[V]) findChild(k byte) *node[V] {
+	if ref := n.key2childRef(k); ref != nil {
+		return *ref
+	}
+	return nil
+}
+
+// 将叶子挂到当前节点：key 恰好在 depth 处结束则作为 leaf，否则以 key[depth] 作为子节点
+// ref 为指向当前节点的槽位，节点膨胀时需替换
+func (n *node[V]) addLeaf(ref **node[V], depth int, l *node[V]) {
+	key := l.asLeaf().key
+	if len(key) == depth {
+		n.asInner().leaf = l
+		return
+	}
+	n.addChild(ref, key[depth], l)
 }
 
 // 通过 key 查找 child 的索引位置
-func (n *node) key2childIndex(k byte) int {
+func (n *node[V]) key2childIndex(k byte) int {
 	switch n.nodeType {
-	case NODE4, NODE16:
-		for i := 0; i < n.size; i++ { // 只能逐个对比 // TODO: NODE16 SSE 优化查找速度
-			if n.keys[i] == k {
+	case NODE4:
+		n4 := n.asNode4()
+		for i := 0; i < int(n4.size); i++ { // 只有 4 个 key，逐个对比即可
+			if n4.keys[i] == k {
 				return i
 			}
 		}
 		return -1
+	case NODE16:
+		n16 := n.asNode16()
+		return findKey16(&n16.keys, k, int(n16.size)) // 一次比较多个字节
 	case NODE48:
-		i := int(n.keys[k]) // 直接取索引
+		i := int(n.asNode48().keys[k]) // 直接取索引
 		if i > 0 {
 			return i - 1 // node16 膨胀为 node48 时，所有的 key 都自增了 1，此处需还原 child 真正的索引位置
 		}
@@ -197,65 +276,156 @@ func (n *node) key2childIndex(k byte) int {
 }
 
 // 比较与 other 的公共前缀部分的长度
-func (n *node) matchPrefixLen(other *node, start int) int {
-	end := utils.Min(len(n.key), len(other.key))
+func (l *leaf[V]) matchPrefixLen(other *leaf[V], start int) int {
+	end := utils.Min(len(l.key), len(other.key))
 	i := start
 	for ; i < end; i++ {
-		if n.key[i] != other.key[i] {
+		if l.key[i] != other.key[i] {
 			return i - start
 		}
 	}
 	return i - start
 }
 
-// 与 key 比较，获取第一个不匹配字节在 n.key 中的索引位置
-func (n *node) mismatchPrefixLen(key []byte, depth int) int {
-	if n.prefixLen <= MAX_PREFIX_LEN {
-		// 悲观模式：逐个比较
-		for i := 0; i < n.prefixLen; i++ {
-			if key[depth+i] != n.prefix[i] {
-				return i
-			}
-		}
-	} else {
-		i := 0
-		for ; i < MAX_PREFIX_LEN; i++ {
-			if key[depth+i] != n.prefix[depth+i] {
-				return i
-			}
+// 与 key 比较，获取第一个不匹配字节在前缀中的索引位置
+// key 在前缀中途结束时，返回 key 剩余的长度
+// 先比较 prefix 中存储的前 stored 字节，前缀更长时再取最左叶子节点的完整 key 比较剩余部分，结果总是精确的
+func (n *inner[V]) mismatchPrefixLen(key []byte, depth, stored int) int {
+	prefixLen := int(n.prefixLen)
+	max := utils.Min(prefixLen, len(key)-depth)
+
+	// 悲观模式：逐个比较存储的前缀
+	i := 0
+	for ; i < utils.Min(max, stored); i++ {
+		if key[depth+i] != n.prefix[i] {
+			return i
 		}
-		// 切换为乐观模式：取最左叶子节点的完整 key，再逐一比较
+	}
+
+	// 乐观模式：prefix 只存了前 stored 字节，剩余部分与最左叶子节点的完整 key 逐一比较
+	if prefixLen > stored {
 		leftestLeaf := n.minChild()
-		for ; i < n.prefixLen; i++ {
+		for ; i < max; i++ {
 			if key[depth+i] != leftestLeaf.key[depth+i] {
 				return i
 			}
 		}
 	}
 
-	return n.prefixLen // 当前节点的索引完全匹配
+	return max // 当前节点的索引完全匹配
+}
+
+// 只读路径的乐观比较：只比较 prefix 中存储的部分并跳过完整的前缀长度
+// 可能误判为匹配，由最终到达的叶子节点校验完整 key
+func (n *inner[V]) checkPrefix(key []byte, depth, stored int) bool {
+	prefixLen := int(n.prefixLen)
+	if len(key)-depth < prefixLen {
+		return false // key 比子树中的所有 key 都短
+	}
+	stored = utils.Min(prefixLen, stored)
+	return bytes.Equal(key[depth:depth+stored], n.prefix[:stored])
 }
 
 // 获取最左边的叶子节点，即整棵树的最小 KEY
-func (n *node) minChild() *node {
+func (n *node[V]) minChild() *leaf[V] {
 	switch n.nodeType {
 	case LEAF:
-		return n
+		return n.asLeaf()
+	case NODE4, NODE16, NODE48, NODE256:
+		if l := n.asInner().leaf; l != nil {
+			return l.asLeaf() // 是所有子节点 key 的前缀，必然最小
+		}
+		_, child := n.childGE(0)
+		return child.minChild()
+	default:
+		panic(fmt.Sprintf("unknow node type: %d", n.nodeType))
+	}
+}
+
+// 获取最右边的叶子节点，即整棵树的最大 KEY
+func (n *node[V]) maxChild() *leaf[V] {
+	switch n.nodeType {
+	case LEAF:
+		return n.asLeaf()
+	case NODE4, NODE16, NODE48, NODE256:
+		if _, child := n.childLE(255); child != nil {
+			return child.maxChild()
+		}
+		return n.asInner().leaf.asLeaf()
+	default:
+		panic(fmt.Sprintf("unknow node type: %d", n.nodeType))
+	}
+}
+
+// 按字节序查找第一个 >= k 的子节点，返回其 key 和指针，不存在则返回 -1
+// NODE48 和 NODE256 的 childs 不按 key 有序，需按 key 逐个字节扫描
+func (n *node[V]) childGE(k int) (int, *node[V]) {
+	switch n.nodeType {
 	case NODE4, NODE16:
-		return n.childs[0].minChild()
+		keys, childs := n.sortedChilds()
+		for i := 0; i < int(n.asInner().size); i++ {
+			if int(keys[i]) >= k {
+				return int(keys[i]), childs[i]
+			}
+		}
 	case NODE48:
-		i := 0
-		for n.childs[i] == nil {
-			i++
+		n48 := n.asNode48()
+		for b := k; b < len(n48.keys); b++ {
+			if i := n48.keys[b]; i > 0 {
+				return b, n48.childs[i-1]
+			}
 		}
-		return n.childs[i-1].minChild() // 同样要 -1 还原 child 的真实索引
 	case NODE256:
-		i := 0
-		for n.childs[i] == nil {
-			i++
+		n256 := n.asNode256()
+		for b := k; b < len(n256.childs); b++ {
+			if n256.childs[b] != nil {
+				return b, n256.childs[b]
+			}
+		}
+	}
+	return -1, nil
+}
+
+// 按字节序查找最后一个 <= k 的子节点，不存在则返回 -1
+func (n *node[V]) childLE(k int) (int, *node[V]) {
+	switch n.nodeType {
+	case NODE4, NODE16:
+		keys, childs := n.sortedChilds()
+		for i := int(n.asInner().size) - 1; i >= 0; i-- {
+			if int(keys[i]) <= k {
+				return int(keys[i]), childs[i]
+			}
+		}
+	case NODE48:
+		n48 := n.asNode48()
+		for b := utils.Min(k, len(n48.keys)-1); b >= 0; b-- {
+			if i := n48.keys[b]; i > 0 {
+				return b, n48.childs[i-1]
+			}
+		}
+	case NODE256:
+		n256 := n.asNode256()
+		for b := utils.Min(k, len(n256.childs)-1); b >= 0; b-- {
+			if n256.childs[b] != nil {
+				return b, n256.childs[b]
+			}
+		}
+	}
+	return -1, nil
+}
+
+// 按字节序遍历 n 子树下的所有叶子节点，内部节点的 leaf 先于所有子节点，fn 返回 false 则提前结束
+func (n *node[V]) walk(fn func(l *leaf[V]) bool) bool {
+	if n.isLeaf() {
+		return fn(n.asLeaf())
+	}
+	if l := n.asInner().leaf; l != nil && !fn(l.asLeaf()) {
+		return false
+	}
+	for k, child := n.childGE(0); child != nil; k, child = n.childGE(k + 1) {
+		if !child.walk(fn) {
+			return false
 		}
-		return n.childs[i].minChild()
-	default:
-		panic(fmt.Sprintf("unknow node type: %d", n.nodeType))
 	}
+	return true
 }
@@ -0,0 +1,50 @@
+package art
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// NODE16 的 16 个 key 有序且连续存放，可以一次比较多个字节，代替逐个比较
+// amd64 下使用 SSE2 一次比较 16 字节，其他平台或指定 purego 构建标签时使用纯 Go 的 SWAR 实现，每次比较 8 字节
+//
+// findKey16(keys, k, size)    返回 k 在 keys[:size] 中的索引，不存在则返回 -1
+// upperBound16(keys, k, size) 返回 keys[:size] 中第一个 > k 的索引，不存在则返回 size
+
+const (
+	lo8 = 0x0101010101010101
+	hi8 = 0x8080808080808080
+)
+
+func findKey16SWAR(keys *[16]byte, k byte, size int) int {
+	kk := lo8 * uint64(k) // 将 k 广播到 8 个字节
+	for i := 0; i < size; i += 8 {
+		// 相等的字节异或后为 0，再用 haszero 技巧标记为 0 的字节
+		// 借位只会从为 0 的字节向高位传播，因此最低的标记位一定准确
+		x := binary.LittleEndian.Uint64(keys[i:]) ^ kk
+		if m := (x - lo8) &^ x & hi8; m != 0 {
+			if j := i + bits.TrailingZeros64(m)/8; j < size {
+				return j
+			}
+			return -1
+		}
+	}
+	return -1
+}
+
+func upperBound16SWAR(keys *[16]byte, k byte, size int) int {
+	kk := lo8 * uint64(k)
+	for i := 0; i < size; i += 8 {
+		a := binary.LittleEndian.Uint64(keys[i:])
+		// 最高位不同时，a 的最高位为 1 则更大
+		// 最高位相同时比较低 7 位：每个字节的 (a|0x80) - (k&0x7f + 1) 不会向相邻字节借位，结果最高位为 1 即 a 的低 7 位更大
+		t := (a | hi8) - (kk&^hi8 + lo8)
+		if m := (a&^kk | ^(a^kk)&t) & hi8; m != 0 {
+			if j := i + bits.TrailingZeros64(m)/8; j < size {
+				return j
+			}
+			return size
+		}
+	}
+	return size
+}
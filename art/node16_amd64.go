@@ -0,0 +1,11 @@
+//go:build amd64 && !purego
+
+package art
+
+// SSE2 是 amd64 的基础指令集，无需运行时检测，实现见 node16_amd64.s
+
+//go:noescape
+func findKey16(keys *[16]byte, k byte, size int) int
+
+//go:noescape
+func upperBound16(keys *[16]byte, k byte, size int) int
@@ -0,0 +1,61 @@
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+// 将 k 广播到 X0 的 16 个字节
+#define BROADCAST_K \
+	MOVBQZX   k+8(FP), AX; \
+	MOVQ      AX, X0;      \
+	PUNPCKLBW X0, X0;      \
+	PUNPCKLWL X0, X0;      \
+	PSHUFL    $0, X0, X0
+
+// 将 DX 中 size 之后的比较结果清零：DX &= (1<<size)-1
+#define MASK_SIZE \
+	MOVQ size+16(FP), CX; \
+	MOVQ $1, BX;          \
+	SHLQ CX, BX;          \
+	DECQ BX;              \
+	ANDQ BX, DX
+
+// func findKey16(keys *[16]byte, k byte, size int) int
+TEXT ·findKey16(SB), NOSPLIT, $0-32
+	MOVQ keys+0(FP), SI
+	BROADCAST_K
+	MOVOU    (SI), X1
+	PCMPEQB  X0, X1 // 相等的字节置为 0xff
+	PMOVMSKB X1, DX // 每个字节的最高位组成 16 位掩码
+	MASK_SIZE
+	JZ       notfound
+	BSFQ     DX, AX
+	MOVQ     AX, ret+24(FP)
+	RET
+
+notfound:
+	MOVQ $-1, ret+24(FP)
+	RET
+
+// func upperBound16(keys *[16]byte, k byte, size int) int
+TEXT ·upperBound16(SB), NOSPLIT, $0-32
+	MOVQ keys+0(FP), SI
+	BROADCAST_K
+	MOVOU (SI), X1
+
+	// PCMPGTB 是有符号比较，两边先翻转最高位，转为无符号比较
+	MOVQ       $0x8080808080808080, AX
+	MOVQ       AX, X2
+	PUNPCKLQDQ X2, X2
+	PXOR       X2, X0
+	PXOR       X2, X1
+	PCMPGTB    X0, X1 // keys[i] > k 的字节置为 0xff
+	PMOVMSKB   X1, DX
+	MASK_SIZE
+	JZ         none
+	BSFQ       DX, AX
+	MOVQ       AX, ret+24(FP)
+	RET
+
+none:
+	MOVQ size+16(FP), AX
+	MOVQ AX, ret+24(FP)
+	RET
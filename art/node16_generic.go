@@ -0,0 +1,11 @@
+//go:build !amd64 || purego
+
+package art
+
+func findKey16(keys *[16]byte, k byte, size int) int {
+	return findKey16SWAR(keys, k, size)
+}
+
+func upperBound16(keys *[16]byte, k byte, size int) int {
+	return upperBound16SWAR(keys, k, size)
+}
@@ -5,215 +5,205 @@ import (
 )
 
 // 为当前节点添加子节点 newChild，索引 key 是 diffKey
-// 如果当前节点已满则膨胀
-func (n *node) addChild(diffKey byte, newChild *node) {
-	cur := n
-	switch cur.nodeType {
+// 如果当前节点已满则膨胀，膨胀后的新节点写入 ref 指向的槽位
+func (n *node[V]) addChild(ref **node[V], diffKey byte, newChild *node[V]) {
+	if n.isFull() {
+		// 当前节点已满，拷贝数据并膨胀
+		next := n.grow()
+		*ref = next
+		next.addChild(ref, diffKey, newChild)
+		return
+	}
+
+	switch n.nodeType {
 	case NODE4, NODE16:
-		if !n.isFull() {
-			i := n.makeRoomForNewChild(diffKey) // 类比数组的查找插入操作
-			cur.keys[i] = diffKey
-			cur.childs[i] = newChild
-			cur.size++
-		} else {
-			// 当前节点已满，拷贝数据并膨胀
-			n.grow()
-			n.addChild(diffKey, newChild)
-		}
+		keys, childs := n.sortedChilds()
+		i := n.makeRoomForNewChild(diffKey) // 类比数组的查找插入操作
+		keys[i] = diffKey
+		childs[i] = newChild
 	case NODE48:
-		if !n.isFull() {
-			var i int
-			var child *node
-			for i, child = range n.childs {
-				if child == nil {
-					break
-				}
-			}
-			n.childs[i] = newChild
-			n.keys[diffKey] = byte(i + 1) // 同样要错位
-			n.size++
-		} else {
-			n.grow()
-			n.addChild(diffKey, newChild)
+		n48 := n.asNode48()
+		i := 0
+		for n48.childs[i] != nil { // 复用删除后空出的槽位
+			i++
 		}
+		n48.childs[i] = newChild
+		n48.keys[diffKey] = byte(i + 1) // 同样要错位
 	case NODE256:
-		if !n.isFull() {
-			n.childs[diffKey] = newChild
-			n.size++
-		}
+		n.asNode256().childs[diffKey] = newChild // 256 个槽位覆盖所有字节，无需膨胀
 	}
+	n.asInner().size++
 }
 
-// 节点膨胀
-func (n *node) grow() {
+// 节点膨胀，返回膨胀后的新节点
+func (n *node[V]) grow() *node[V] {
 	switch n.nodeType {
 	// 4 -> 16
 	case NODE4:
-		next := newNode16()
-		next.copyMeta(n)
-		for i := 0; i < n.size; i++ { // 直接逐个复制 key 和 child
-			next.keys[i] = n.keys[i]
-			next.childs[i] = n.childs[i]
-		}
-		n.replacedBy(next) // cur 会被 GC
+		n4 := n.asNode4()
+		next := newNode16[V]()
+		next.copyMeta(&n4.inner)
+		copy(next.keys[:], n4.keys[:]) // 直接逐个复制 key 和 child
+		copy(next.childs[:], n4.childs[:])
+		return &next.node // n 会被 GC
 
 	// 16 -> 48
 	case NODE16:
-		next := newNode48()
-		next.copyMeta(n)
-		for i, k := range n.keys {
-			next.childs[i] = *(n.key2childRef(k))
+		n16 := n.asNode16()
+		next := newNode48[V]()
+		next.copyMeta(&n16.inner)
+		for i := 0; i < int(n16.size); i++ {
+			next.childs[i] = n16.childs[i]
 
 			// node48 和 node256 一样，都有 256 个 key，但只有 48 childs 指针，不是对应的
 			// 这么设计提高了查询速度，也节省了存储空间
 			// node48.keys 在初始化时都是 0 值，都会索引到 node48.childs[0] 上
 			// 为避免误判，约定将 childs 的索引位置 +1 后再存入 keys，读取时再 -1 即可
-			next.keys[k] = byte(i + 1)
+			next.keys[n16.keys[i]] = byte(i + 1)
 		}
-		n.replacedBy(next)
+		return &next.node
 
 	// 48 -> 256
 	case NODE48:
-		next := newNode256()
-		next.copyMeta(n)
-		// 逐一复制非空节点
-		for _, k := range n.keys {
-			next.childs[k] = *(n.key2childRef(k))
+		n48 := n.asNode48()
+		next := newNode256[V]()
+		next.copyMeta(&n48.inner)
+		// 逐一复制非空节点，n.keys 的下标才是子节点的 key
+		for k, i := range n48.keys {
+			if i > 0 {
+				next.childs[k] = n48.childs[i-1]
+			}
 		}
-		n.replacedBy(next)
-
-	case NODE256:
-		panic("node256 needn't grow")
+		return &next.node
 	}
+	panic("node256 needn't grow")
 }
 
-// 节点收缩
-func (n *node) shrink() {
+// 节点收缩，返回替换当前节点的新节点，调用方需将其写回父节点的槽位
+// stored 为节点中存储的前缀长度，合并前缀时使用
+func (n *node[V]) shrink(stored int) *node[V] {
 	switch n.nodeType {
 	// 4 -> 1
 	case NODE4:
+		n4 := n.asNode4()
+		// 剩余的 leaf 与唯一子节点依旧是合法的 NODE4，只剩 leaf 则直接替换
+		if n4.leaf != nil {
+			if n4.size == 0 {
+				return n4.leaf
+			}
+			return n
+		}
+
 		// 合并唯一子节点
-		onlyChild := n.childs[0]
+		onlyChild := n4.childs[0]
 
 		if onlyChild.isLeaf() { // 唯一子节点为叶子节点，则直接替换
-			n.replacedBy(onlyChild)
-			return
+			return onlyChild
 		}
 
-		// 其他子节点需合并前缀
-		if n.prefixLen < MAX_PREFIX_LEN {
-			utils.Memcpy(n.prefix[n.prefixLen:], onlyChild.prefix, MAX_PREFIX_LEN)
-		}
-		n.prefixLen += onlyChild.prefixLen
-		n.size = onlyChild.size
+		// 其他子节点需合并前缀：n 的前缀 + 指向子节点的 key + 子节点的前缀
+		// 乐观模式下 prefix 只存了前 stored 字节，拼接结果同样只需保留前 stored 字节
+		child := onlyChild.asInner()
+		merged := make([]byte, 0, MAX_PREFIX_LEN+1+MAX_PREFIX_LEN)
+		merged = append(merged, n4.prefix[:utils.Min(int(n4.prefixLen), stored)]...)
+		merged = append(merged, n4.keys[0])
+		merged = append(merged, child.prefix[:utils.Min(int(child.prefixLen), stored)]...)
+		utils.Memcpy(child.prefix[:], merged, stored)
+		child.prefixLen += n4.prefixLen + 1
 
-		// 替换指向
-		n.keys = onlyChild.keys
-		n.childs = onlyChild.childs
+		// 替换为子节点
+		return onlyChild
 
 	// 16 -> 4
 	case NODE16:
-		prev := newNode4()
-		prev.copyMeta(n)
+		n16 := n.asNode16()
+		prev := newNode4[V]()
+		prev.copyMeta(&n16.inner)
 		// 直接逐个替换
-		for i := 0; i < MIN_NODE16; i++ {
-			prev.keys[i] = n.keys[i]
-			prev.childs[i] = n.childs[i]
-		}
-		n.replacedBy(prev)
+		copy(prev.keys[:], n16.keys[:n16.size])
+		copy(prev.childs[:], n16.childs[:n16.size])
+		return &prev.node
 
 	// 48 -> 16
 	case NODE48:
-		prev := newNode16()
-		prev.copyMeta(n)
+		n48 := n.asNode48()
+		prev := newNode16[V]()
+		prev.copyMeta(&n48.inner)
 		childIdx := 0
-		for _, k := range n.keys {
-			if idx := n.key2childIndex(k); idx != -1 {
-				prev.childs[childIdx] = n.childs[idx] // 有序遍历，有序替换
-				prev.keys[childIdx] = k
+		for k, idx := range n48.keys { // n.keys 的下标才是子节点的 key，按下标遍历即有序
+			if idx > 0 {
+				prev.childs[childIdx] = n48.childs[idx-1]
+				prev.keys[childIdx] = byte(k)
 				childIdx++
 			}
 		}
-		n.replacedBy(prev)
+		return &prev.node
 
 	// 256 -> 48
 	case NODE256:
-		prev := newNode48()
-		prev.copyMeta(n)
+		n256 := n.asNode256()
+		prev := newNode48[V]()
+		prev.copyMeta(&n256.inner)
 		childIdx := 0
-		for _, k := range n.keys {
-			if child := n.childs[n.key2childIndex(k)]; child != nil {
+		for k, child := range n256.childs {
+			if child != nil {
 				prev.childs[childIdx] = child
 				prev.keys[k] = byte(childIdx + 1) // 依旧自增
 				childIdx++
 			}
 		}
-		n.replacedBy(prev)
+		return &prev.node
 	}
+	return n
 }
 
-// 替换当前节点
-func (n *node) replacedBy(newNode *node) {
-	*n = *newNode
-}
-
-// 数组查找插入操作
-func (n *node) makeRoomForNewChild(diffKey byte) int {
-	if n.nodeType != NODE4 && n.nodeType != NODE16 {
-		panic("")
-	}
-	i := 0
-	for ; i < n.size; i++ {
-		if diffKey < n.keys[i] {
-			break
+// 数组查找插入操作：找到第一个比 diffKey 大的位置，并将其后的 key 和 child 后移一位
+func (n *node[V]) makeRoomForNewChild(diffKey byte) int {
+	keys, childs := n.sortedChilds()
+	size := int(n.asInner().size)
+	var i int
+	switch n.nodeType {
+	case NODE4:
+		for ; i < size; i++ {
+			if diffKey < keys[i] {
+				break
+			}
 		}
+	case NODE16:
+		i = upperBound16(&n.asNode16().keys, diffKey, size)
 	}
 
-	// TODO: NODE16 SSE 可优化
-	for j := n.size; j > i; j-- {
-		if n.keys[j-1] > diffKey {
-			n.keys[j] = n.keys[j-1]
-			n.childs[j] = n.childs[j-1]
-		}
-	}
+	copy(keys[i+1:size+1], keys[i:size])
+	copy(childs[i+1:size+1], childs[i:size])
 	return i
 }
 
 // 从内部节点中删除单个 key
-func (n *node) delete(k byte) {
+func (n *node[V]) delete(k byte) {
 	if n.isLeaf() {
 		return
 	}
+	if n.key2childRef(k) == nil {
+		return
+	}
 	i := n.key2childIndex(k)
-	j := 0
-	var k2 byte
 
 	switch n.nodeType {
 	case NODE4, NODE16: // 删除后 keys 和 childs 必须还对应
-		// 删除 child
 		// 数组删除中间元素操作
-		for ; i < n.size-1; i++ {
-			n.childs[i] = n.childs[i+1]
-		}
-		n.childs[i] = nil
-
-		// 删除 key
-		for j, k2 = range n.keys {
-			if k == k2 {
-				break
-			}
-		}
-		for ; j < n.size-1; j++ {
-			n.keys[j] = n.keys[j+1]
-		}
-		n.keys[j] = byte(0)
+		keys, childs := n.sortedChilds()
+		size := int(n.asInner().size)
+		copy(keys[i:], keys[i+1:size])
+		copy(childs[i:], childs[i+1:size])
+		keys[size-1] = byte(0)
+		childs[size-1] = nil
 	case NODE48:
-		// 将 keys 对应置空即可
-		childIdx := int(n.keys[i]) - 1
-		n.childs[childIdx] = nil
-		n.keys[k] = byte(0)
+		// 将 keys 对应置空即可，空出的 childs 槽位会被 addChild 复用
+		n48 := n.asNode48()
+		n48.childs[i] = nil
+		n48.keys[k] = byte(0)
 	case NODE256:
-		n.childs[int(n.keys[i])] = nil
-		n.keys[k] = byte(0)
+		n.asNode256().childs[k] = nil
 	}
+	n.asInner().size--
 }
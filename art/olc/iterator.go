@@ -0,0 +1,367 @@
+package olc
+
+import (
+	"bytes"
+	"iter"
+	"trees"
+)
+
+var _ trees.Tree[int] = (*Tree[int])(nil)
+var _ trees.IndexTree = (*ArtTree)(nil)
+
+// 有序双向迭代器，可以与写者并发使用
+// 只记录当前所在的叶子节点，每次移动都从 root 重新查找当前 key 的后继或前驱，
+// 因此不会持有任何锁，也能看到迭代期间其它 goroutine 对未遍历部分的修改
+type Iterator[V any] struct {
+	tree *Tree[V]
+	leaf *leaf[V]
+}
+
+func (t *Tree[V]) Iterator() trees.Cursor[V] {
+	return &Iterator[V]{tree: t}
+}
+
+// 升序遍历
+func (t *Tree[V]) All() iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		it := &Iterator[V]{tree: t}
+		for ok := it.SeekToFirst(); ok; ok = it.Next() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// 降序遍历
+func (t *Tree[V]) Backward() iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		it := &Iterator[V]{tree: t}
+		for ok := it.SeekToLast(); ok; ok = it.Prev() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+func (it *Iterator[V]) SeekToFirst() bool {
+	it.leaf = it.tree.ceiling(nil, true)
+	return it.Valid()
+}
+
+func (it *Iterator[V]) SeekToLast() bool {
+	it.leaf = it.tree.last()
+	return it.Valid()
+}
+
+// 定位到第一个 >= key 的叶子节点
+func (it *Iterator[V]) Seek(key []byte) bool {
+	it.leaf = it.tree.ceiling(key, true)
+	return it.Valid()
+}
+
+// 定位到最后一个 <= key 的叶子节点
+func (it *Iterator[V]) SeekForPrev(key []byte) bool {
+	it.leaf = it.tree.floor(key, true)
+	return it.Valid()
+}
+
+func (it *Iterator[V]) Next() bool {
+	if !it.Valid() {
+		return false
+	}
+	it.leaf = it.tree.ceiling(it.leaf.key, false)
+	return it.Valid()
+}
+
+func (it *Iterator[V]) Prev() bool {
+	if !it.Valid() {
+		return false
+	}
+	it.leaf = it.tree.floor(it.leaf.key, false)
+	return it.Valid()
+}
+
+func (it *Iterator[V]) Valid() bool {
+	return it.leaf != nil
+}
+
+func (it *Iterator[V]) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.leaf.key
+}
+
+func (it *Iterator[V]) Value() (v V) {
+	if !it.Valid() {
+		return v
+	}
+	return it.leaf.val
+}
+
+// 第一个 >= key 的叶子节点，inclusive 为 false 时为第一个 > key 的叶子节点
+func (t *Tree[V]) ceiling(key []byte, inclusive bool) *leaf[V] {
+	for {
+		v, _ := t.root.readLock()
+		if l, ok := t.ge(t.root, v, 0, key, inclusive); ok {
+			return l
+		}
+	}
+}
+
+// 最后一个 <= key 的叶子节点，inclusive 为 false 时为最后一个 < key 的叶子节点
+func (t *Tree[V]) floor(key []byte, inclusive bool) *leaf[V] {
+	for {
+		v, _ := t.root.readLock()
+		if l, ok := t.le(t.root, v, 0, key, inclusive); ok {
+			return l
+		}
+	}
+}
+
+func (t *Tree[V]) last() *leaf[V] {
+	for {
+		if l, ok := t.root.maxLeaf(); ok {
+			return l
+		}
+	}
+}
+
+// 与 key 比较子树 n 的完整前缀，c < 0 表示整棵子树都大于 key，c > 0 表示都小于 key
+// c == 0 时 key 在 depth 之后还有剩余字节，返回跳过前缀后的 depth
+func (n *node[V]) comparePrefix(key []byte, depth int) (c, next int, ok bool) {
+	var buf [MAX_PREFIX_LEN]byte
+	prefix, ok := n.fullPrefix(depth, &buf)
+	if !ok {
+		return 0, 0, false
+	}
+	end := min(len(key), depth+len(prefix))
+	c = bytes.Compare(key[depth:end], prefix[:end-depth])
+	if c == 0 && end < depth+len(prefix) {
+		c = -1 // key 在前缀内结束，是整棵子树的前缀
+	}
+	return c, depth + len(prefix), true
+}
+
+// 子树 n 中第一个 >= key 的叶子节点，沿 key 下沉，子树中没有则取下一个兄弟子树的最小叶子
+// v 为调用方读到的 n 的版本号，每读完节点的一部分都校验版本号，ok 为 false 时需从 root 重试
+func (t *Tree[V]) ge(n *node[V], v uint64, depth int, key []byte, inclusive bool) (*leaf[V], bool) {
+	c, depth, ok := n.comparePrefix(key, depth)
+	switch {
+	case !ok:
+		return nil, false
+	case c < 0:
+		l, ok := n.minLeaf()
+		return l, ok && n.check(v)
+	case c > 0:
+		return nil, n.check(v)
+	}
+
+	// n.leaf 恰好等于 key，其余子节点都大于 key
+	in := n.asInner()
+	if depth == len(key) {
+		next := in.leaf.Load()
+		if next == nil || !inclusive {
+			_, next = n.childGE(0)
+		}
+		if !n.check(v) {
+			return nil, false
+		}
+		if next == nil {
+			return nil, true
+		}
+		return next.minLeaf()
+	}
+
+	k := int(key[depth])
+	if child := n.findChild(key[depth]); child != nil {
+		if child.isLeaf() {
+			l := child.asLeaf()
+			if !n.check(v) {
+				return nil, false
+			}
+			if c := bytes.Compare(l.key, key); c > 0 || c == 0 && inclusive {
+				return l, true
+			}
+		} else {
+			// 先读子节点的版本号再校验 n，保证子节点仍挂在 n 下且前缀未被分裂
+			cv, ok := child.readLock()
+			if !ok || !n.check(v) {
+				return nil, false
+			}
+			if l, ok := t.ge(child, cv, depth+1, key, inclusive); !ok || l != nil {
+				return l, ok
+			}
+		}
+	}
+	_, next := n.childGE(k + 1)
+	if !n.check(v) {
+		return nil, false
+	}
+	if next == nil {
+		return nil, true
+	}
+	return next.minLeaf()
+}
+
+// 子树 n 中最后一个 <= key 的叶子节点，子树中没有则取上一个兄弟子树的最大叶子，再没有则取 n.leaf
+func (t *Tree[V]) le(n *node[V], v uint64, depth int, key []byte, inclusive bool) (*leaf[V], bool) {
+	c, depth, ok := n.comparePrefix(key, depth)
+	switch {
+	case !ok:
+		return nil, false
+	case c < 0:
+		return nil, n.check(v)
+	case c > 0:
+		l, ok := n.maxLeaf()
+		return l, ok && n.check(v)
+	}
+
+	// 只有 n.leaf 可能等于 key，其余子节点都大于 key
+	in := n.asInner()
+	if depth == len(key) {
+		next := in.leaf.Load()
+		if !n.check(v) {
+			return nil, false
+		}
+		if next == nil || !inclusive {
+			return nil, true
+		}
+		return next.asLeaf(), true
+	}
+
+	k := int(key[depth])
+	if child := n.findChild(key[depth]); child != nil {
+		if child.isLeaf() {
+			l := child.asLeaf()
+			if !n.check(v) {
+				return nil, false
+			}
+			if c := bytes.Compare(l.key, key); c < 0 || c == 0 && inclusive {
+				return l, true
+			}
+		} else {
+			cv, ok := child.readLock()
+			if !ok || !n.check(v) {
+				return nil, false
+			}
+			if l, ok := t.le(child, cv, depth+1, key, inclusive); !ok || l != nil {
+				return l, ok
+			}
+		}
+	}
+	_, next := n.childLE(k - 1)
+	if next == nil {
+		next = in.leaf.Load() // 比 key 短的前缀，小于 key
+	}
+	if !n.check(v) {
+		return nil, false
+	}
+	if next == nil {
+		return nil, true
+	}
+	return next.maxLeaf()
+}
+
+// 最小 key，空树则 k 为 nil
+func (t *Tree[V]) Min() (k []byte, v V) {
+	return t.result(t.ceiling(nil, true))
+}
+
+// 最大 key，空树则 k 为 nil
+func (t *Tree[V]) Max() (k []byte, v V) {
+	return t.result(t.last())
+}
+
+// 最后一个 <= key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Floor(key []byte) (k []byte, v V) {
+	return t.result(t.floor(key, true))
+}
+
+// 第一个 >= key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Ceiling(key []byte) (k []byte, v V) {
+	return t.result(t.ceiling(key, true))
+}
+
+// 最后一个 < key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Lower(key []byte) (k []byte, v V) {
+	return t.result(t.floor(key, false))
+}
+
+// 第一个 > key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Higher(key []byte) (k []byte, v V) {
+	return t.result(t.ceiling(key, false))
+}
+
+// 叶子节点不会被修改，其 key 可以直接返回给调用方
+func (t *Tree[V]) result(l *leaf[V]) (k []byte, v V) {
+	if l == nil {
+		return nil, v
+	}
+	return l.key, l.val
+}
+
+// 删除并返回最小 key，空树则 k 为 nil
+// 查找与删除之间其它 goroutine 可能写入更小的 key；最小 key 先被其它 goroutine 删除则重新查找
+func (t *Tree[V]) PopMin() (k []byte, v V) {
+	for {
+		if k, _ = t.Min(); k == nil {
+			return nil, v
+		}
+		if v, ok := t.Delete(k); ok {
+			return k, v
+		}
+	}
+}
+
+// 删除并返回最大 key，空树则 k 为 nil
+func (t *Tree[V]) PopMax() (k []byte, v V) {
+	for {
+		if k, _ = t.Max(); k == nil {
+			return nil, v
+		}
+		if v, ok := t.Delete(k); ok {
+			return k, v
+		}
+	}
+}
+
+// 升序遍历 [start, end) 内的 key，start 为 nil 则从最小 key 开始，end 为 nil 则遍历到最大 key
+// fn 返回 false 则提前结束
+func (t *Tree[V]) Range(start, end []byte, fn func(k []byte, v V) bool) {
+	it := &Iterator[V]{tree: t}
+	for ok := it.Seek(start); ok; ok = it.Next() {
+		if end != nil && bytes.Compare(it.Key(), end) >= 0 {
+			return
+		}
+		if !fn(it.Key(), it.Value()) {
+			return
+		}
+	}
+}
+
+// 升序遍历所有以 prefix 为前缀的 key，fn 返回 false 则提前结束
+func (t *Tree[V]) WalkPrefix(prefix []byte, fn func(k []byte, v V) bool) {
+	it := &Iterator[V]{tree: t}
+	for ok := it.Seek(prefix); ok && bytes.HasPrefix(it.Key(), prefix); ok = it.Next() {
+		if !fn(it.Key(), it.Value()) {
+			return
+		}
+	}
+}
+
+func (t *Tree[V]) HasPrefix(prefix []byte) bool {
+	l := t.ceiling(prefix, true)
+	return l != nil && bytes.HasPrefix(l.key, prefix)
+}
+
+func (t *Tree[V]) CountPrefix(prefix []byte) int {
+	cnt := 0
+	t.WalkPrefix(prefix, func([]byte, V) bool {
+		cnt++
+		return true
+	})
+	return cnt
+}
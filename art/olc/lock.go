@@ -0,0 +1,56 @@
+package olc
+
+import "runtime"
+
+// 节点的版本锁，version 的最低位标记节点已废弃，次低位标记已加写锁，其余位为版本号
+// 读者不加锁：读取前记录版本号，读取后校验版本号未变化，否则从 root 重试
+// 写者将读取时的版本号 CAS 升级为写锁，只锁住需要修改的节点
+const (
+	obsoleteBit = 1
+	lockedBit   = 2
+)
+
+// 等待写者释放锁后返回版本号，节点已废弃则返回 false，调用方需重试
+func (n *node[V]) readLock() (uint64, bool) {
+	for {
+		v := n.version.Load()
+		if v&lockedBit != 0 {
+			runtime.Gosched()
+			continue
+		}
+		return v, v&obsoleteBit == 0
+	}
+}
+
+// 校验读取期间节点未被修改
+func (n *node[V]) check(v uint64) bool {
+	return n.version.Load() == v
+}
+
+// 将读取时的版本号升级为写锁，期间节点被修改过则失败
+func (n *node[V]) upgrade(v uint64) bool {
+	return n.version.CompareAndSwap(v, v+lockedBit)
+}
+
+// 直接加写锁，节点已废弃则失败
+func (n *node[V]) writeLock() bool {
+	for {
+		v, ok := n.readLock()
+		if !ok {
+			return false
+		}
+		if n.upgrade(v) {
+			return true
+		}
+	}
+}
+
+// 释放写锁，锁位进位到版本号，使读者的校验失败
+func (n *node[V]) unlock() {
+	n.version.Add(lockedBit)
+}
+
+// 释放写锁并标记节点已废弃，节点已从树中摘除
+func (n *node[V]) unlockObsolete() {
+	n.version.Add(lockedBit + obsoleteBit)
+}
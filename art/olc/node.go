@@ -0,0 +1,512 @@
+package olc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync/atomic"
+	"unsafe"
+)
+
+type nodeType uint8
+
+const (
+	NODE4 nodeType = iota
+	NODE16
+	NODE48
+	NODE256
+	LEAF
+)
+
+// 与 art 包相同，收缩下限比下一级节点的膨胀上限多 1
+const (
+	MIN_NODE4 = 2
+	MAX_NODE4 = 4
+
+	MIN_NODE16 = 5
+	MAX_NODE16 = 16
+
+	MIN_NODE48 = 17
+	MAX_NODE48 = 48
+
+	MIN_NODE256 = 49
+	MAX_NODE256 = 256
+
+	MAX_PREFIX_LEN = 8 // 前缀按小端序打包为一个 uint64 原子读写，超出部分乐观跳过，由叶子节点校验
+)
+
+// 所有节点的公共头部，version 为节点的版本锁，见 lock.go
+// 读者不加锁并发读取节点，因此内部节点中所有会被原地修改的字段都是原子类型
+// 读到的多个字段之间可能不一致，读者在使用前校验版本号，不一致时重试
+type node[V any] struct {
+	version  atomic.Uint64
+	nodeType nodeType
+}
+
+type inner[V any] struct {
+	node[V]
+	size      atomic.Uint32
+	prefixLen atomic.Uint32
+	prefix    atomic.Uint64           // 前 MAX_PREFIX_LEN 字节前缀
+	leaf      atomic.Pointer[node[V]] // 恰好在前缀处结束的 key
+}
+
+// NODE4 和 NODE16 的 keys 有序，每 8 个 key 按小端序打包为一个 uint64
+type node4[V any] struct {
+	inner[V]
+	keys   [1]atomic.Uint64
+	childs [MAX_NODE4]atomic.Pointer[node[V]]
+}
+
+type node16[V any] struct {
+	inner[V]
+	keys   [2]atomic.Uint64
+	childs [MAX_NODE16]atomic.Pointer[node[V]]
+}
+
+// index 以 key 为下标记录 childs 的索引 +1，0 表示不存在，每 8 个索引打包为一个 uint64
+type node48[V any] struct {
+	inner[V]
+	index  [32]atomic.Uint64
+	childs [MAX_NODE48]atomic.Pointer[node[V]]
+}
+
+type node256[V any] struct {
+	inner[V]
+	childs [MAX_NODE256]atomic.Pointer[node[V]]
+}
+
+// 叶子节点创建后不再修改，更新值时整体替换，读者无需校验版本号
+type leaf[V any] struct {
+	node[V]
+	key []byte
+	val V
+}
+
+func newNode4[V any]() *node4[V] {
+	n := &node4[V]{}
+	n.nodeType = NODE4
+	return n
+}
+
+func newNode16[V any]() *node16[V] {
+	n := &node16[V]{}
+	n.nodeType = NODE16
+	return n
+}
+
+func newNode48[V any]() *node48[V] {
+	n := &node48[V]{}
+	n.nodeType = NODE48
+	return n
+}
+
+func newNode256[V any]() *node256[V] {
+	n := &node256[V]{}
+	n.nodeType = NODE256
+	return n
+}
+
+func newLeaf[V any](key []byte, val V) *node[V] {
+	l := &leaf[V]{key: key, val: val}
+	l.nodeType = LEAF
+	return &l.node
+}
+
+func (n *node[V]) isLeaf() bool {
+	return n.nodeType == LEAF
+}
+
+func (n *node[V]) asLeaf() *leaf[V]       { return (*leaf[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asInner() *inner[V]     { return (*inner[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asNode4() *node4[V]     { return (*node4[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asNode16() *node16[V]   { return (*node16[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asNode48() *node48[V]   { return (*node48[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asNode256() *node256[V] { return (*node256[V])(unsafe.Pointer(n)) }
+
+func (n *node[V]) maxSize() int {
+	switch n.nodeType {
+	case NODE4:
+		return MAX_NODE4
+	case NODE16:
+		return MAX_NODE16
+	case NODE48:
+		return MAX_NODE48
+	}
+	return MAX_NODE256
+}
+
+func (n *node[V]) minSize() int {
+	switch n.nodeType {
+	case NODE4:
+		return MIN_NODE4
+	case NODE16:
+		return MIN_NODE16
+	case NODE48:
+		return MIN_NODE48
+	}
+	return MIN_NODE256
+}
+
+func (n *node[V]) isFull() bool {
+	return int(n.asInner().size.Load()) == n.maxSize()
+}
+
+// 前缀字节的打包和解包
+func packPrefix(prefix []byte) uint64 {
+	var buf [MAX_PREFIX_LEN]byte
+	copy(buf[:], prefix)
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+func unpackPrefix(w uint64) (buf [MAX_PREFIX_LEN]byte) {
+	binary.LittleEndian.PutUint64(buf[:], w)
+	return buf
+}
+
+// NODE4 和 NODE16 的有序 keys 和 childs
+func (n *node[V]) sortedChilds() ([]atomic.Uint64, []atomic.Pointer[node[V]]) {
+	if n.nodeType == NODE4 {
+		n4 := n.asNode4()
+		return n4.keys[:], n4.childs[:]
+	}
+	n16 := n.asNode16()
+	return n16.keys[:], n16.childs[:]
+}
+
+func loadKeys(words []atomic.Uint64) (keys [MAX_NODE16]byte) {
+	for i := range words {
+		binary.LittleEndian.PutUint64(keys[i*8:], words[i].Load())
+	}
+	return keys
+}
+
+func storeKeys(words []atomic.Uint64, keys *[MAX_NODE16]byte) {
+	for i := range words {
+		words[i].Store(binary.LittleEndian.Uint64(keys[i*8:]))
+	}
+}
+
+// 读者看到的 size 可能与 keys 不一致，截断到 childs 的容量以免越界
+func (n *node[V]) loadSize(max int) int {
+	return min(int(n.asInner().size.Load()), max)
+}
+
+// NODE48 中 key 对应的 childs 索引 +1
+func (n *node48[V]) childIndex(k byte) int {
+	return int(byte(n.index[k/8].Load() >> (k % 8 * 8)))
+}
+
+func (n *node48[V]) setChildIndex(k byte, i int) {
+	w := &n.index[k/8]
+	shift := k % 8 * 8
+	w.Store(w.Load()&^(0xff<<shift) | uint64(i)<<shift)
+}
+
+// 查找 key 为 k 的子节点，不存在返回 nil
+func (n *node[V]) findChild(k byte) *node[V] {
+	if ref := n.childRef(k); ref != nil {
+		return ref.Load()
+	}
+	return nil
+}
+
+// key 为 k 的子节点槽位，不存在返回 nil
+func (n *node[V]) childRef(k byte) *atomic.Pointer[node[V]] {
+	switch n.nodeType {
+	case NODE4, NODE16:
+		words, childs := n.sortedChilds()
+		keys := loadKeys(words)
+		size := n.loadSize(len(childs))
+		for i := 0; i < size; i++ {
+			if keys[i] == k {
+				return &childs[i]
+			}
+		}
+	case NODE48:
+		n48 := n.asNode48()
+		if i := n48.childIndex(k); i > 0 && i <= MAX_NODE48 {
+			return &n48.childs[i-1]
+		}
+	case NODE256:
+		if ref := &n.asNode256().childs[k]; ref.Load() != nil {
+			return ref
+		}
+	}
+	return nil
+}
+
+// 第一个 key >= k 的子节点，不存在返回 nil
+func (n *node[V]) childGE(k int) (int, *node[V]) {
+	switch n.nodeType {
+	case NODE4, NODE16:
+		words, childs := n.sortedChilds()
+		keys := loadKeys(words)
+		size := n.loadSize(len(childs))
+		for i := 0; i < size; i++ {
+			if int(keys[i]) >= k {
+				return int(keys[i]), childs[i].Load()
+			}
+		}
+	case NODE48:
+		n48 := n.asNode48()
+		for ; k < MAX_NODE256; k++ {
+			if i := n48.childIndex(byte(k)); i > 0 && i <= MAX_NODE48 {
+				return k, n48.childs[i-1].Load()
+			}
+		}
+	case NODE256:
+		n256 := n.asNode256()
+		for ; k < MAX_NODE256; k++ {
+			if child := n256.childs[k].Load(); child != nil {
+				return k, child
+			}
+		}
+	}
+	return -1, nil
+}
+
+// 最后一个 key <= k 的子节点，不存在返回 nil
+func (n *node[V]) childLE(k int) (int, *node[V]) {
+	switch n.nodeType {
+	case NODE4, NODE16:
+		words, childs := n.sortedChilds()
+		keys := loadKeys(words)
+		size := n.loadSize(len(childs))
+		for i := size - 1; i >= 0; i-- {
+			if int(keys[i]) <= k {
+				return int(keys[i]), childs[i].Load()
+			}
+		}
+	case NODE48:
+		n48 := n.asNode48()
+		for ; k >= 0; k-- {
+			if i := n48.childIndex(byte(k)); i > 0 && i <= MAX_NODE48 {
+				return k, n48.childs[i-1].Load()
+			}
+		}
+	case NODE256:
+		n256 := n.asNode256()
+		for ; k >= 0; k-- {
+			if child := n256.childs[k].Load(); child != nil {
+				return k, child
+			}
+		}
+	}
+	return -1, nil
+}
+
+// 以下方法只由持有写锁的写者，或尚未发布到树中的新节点调用
+
+// 添加子节点，调用方保证节点未满且 k 不存在
+func (n *node[V]) addChild(k byte, child *node[V]) {
+	in := n.asInner()
+	size := int(in.size.Load())
+	switch n.nodeType {
+	case NODE4, NODE16:
+		words, childs := n.sortedChilds()
+		keys := loadKeys(words)
+		pos := 0
+		for pos < size && keys[pos] < k {
+			pos++
+		}
+		for i := size; i > pos; i-- {
+			keys[i] = keys[i-1]
+			childs[i].Store(childs[i-1].Load())
+		}
+		keys[pos] = k
+		storeKeys(words, &keys)
+		childs[pos].Store(child)
+	case NODE48:
+		n48 := n.asNode48()
+		pos := 0
+		for n48.childs[pos].Load() != nil {
+			pos++
+		}
+		n48.childs[pos].Store(child)
+		n48.setChildIndex(k, pos+1)
+	case NODE256:
+		n.asNode256().childs[k].Store(child)
+	}
+	in.size.Store(uint32(size + 1))
+}
+
+// 删除子节点，调用方保证 k 存在
+func (n *node[V]) removeChild(k byte) {
+	in := n.asInner()
+	size := int(in.size.Load())
+	switch n.nodeType {
+	case NODE4, NODE16:
+		words, childs := n.sortedChilds()
+		keys := loadKeys(words)
+		pos := 0
+		for keys[pos] != k {
+			pos++
+		}
+		for i := pos; i < size-1; i++ {
+			keys[i] = keys[i+1]
+			childs[i].Store(childs[i+1].Load())
+		}
+		keys[size-1] = 0
+		storeKeys(words, &keys)
+		childs[size-1].Store(nil)
+	case NODE48:
+		n48 := n.asNode48()
+		n48.childs[n48.childIndex(k)-1].Store(nil)
+		n48.setChildIndex(k, 0)
+	case NODE256:
+		n.asNode256().childs[k].Store(nil)
+	}
+	in.size.Store(uint32(size - 1))
+}
+
+// 拷贝前缀和 leaf 到新节点
+func (in *inner[V]) copyMeta(src *inner[V]) {
+	in.prefixLen.Store(src.prefixLen.Load())
+	in.prefix.Store(src.prefix.Load())
+	in.leaf.Store(src.leaf.Load())
+}
+
+// 拷贝为容量合适的新节点，跳过 key 为 skip 的子节点，skip 为 -1 则拷贝全部
+// 扩容和收缩都不修改原节点，新节点替换原节点后原节点被标记为废弃
+func (n *node[V]) copyTo(dst *node[V], skip int) *node[V] {
+	dst.asInner().copyMeta(n.asInner())
+	for k, child := n.childGE(0); child != nil; k, child = n.childGE(k + 1) {
+		if k != skip {
+			dst.addChild(byte(k), child)
+		}
+	}
+	return dst
+}
+
+func (n *node[V]) grow() *node[V] {
+	switch n.nodeType {
+	case NODE4:
+		return n.copyTo(&newNode16[V]().node, -1)
+	case NODE16:
+		return n.copyTo(&newNode48[V]().node, -1)
+	}
+	return n.copyTo(&newNode256[V]().node, -1)
+}
+
+// 删除 k 后收缩为更小的节点
+func (n *node[V]) shrink(k byte) *node[V] {
+	switch n.nodeType {
+	case NODE16:
+		return n.copyTo(&newNode4[V]().node, int(k))
+	case NODE48:
+		return n.copyTo(&newNode16[V]().node, int(k))
+	}
+	return n.copyTo(&newNode48[V]().node, int(k))
+}
+
+// 叶子节点的 key 在 depth 处结束则存为 leaf，否则以 key[depth] 添加为子节点
+func (n *node[V]) addLeaf(depth int, l *node[V]) {
+	if key := l.asLeaf().key; len(key) == depth {
+		n.asInner().leaf.Store(l)
+	} else {
+		n.addChild(key[depth], l)
+	}
+}
+
+// NODE4 删除后只剩一个 leaf 或子节点，返回用来替换 n 的节点
+// 剩下的是内部节点时需锁住它，把 n 的前缀和它在 n 中的 key 合并到其前缀前面，加锁失败返回 nil
+func (n *node[V]) collapse(atLeaf bool, k byte) *node[V] {
+	in := n.asInner()
+	if l := in.leaf.Load(); !atLeaf && l != nil {
+		return l
+	}
+	ck, child := n.childGE(0)
+	if !atLeaf && byte(ck) == k {
+		ck, child = n.childGE(ck + 1)
+	}
+	if child.isLeaf() {
+		return child
+	}
+	if !child.writeLock() {
+		return nil
+	}
+
+	// 只需拼出存储的前 MAX_PREFIX_LEN 字节，乐观跳过的部分仍由叶子节点提供
+	cin := child.asInner()
+	prefixLen, childPrefixLen := int(in.prefixLen.Load()), int(cin.prefixLen.Load())
+	prefix, childPrefix := unpackPrefix(in.prefix.Load()), unpackPrefix(cin.prefix.Load())
+	var buf [2*MAX_PREFIX_LEN + 1]byte
+	merged := append(buf[:0], prefix[:min(prefixLen, MAX_PREFIX_LEN)]...)
+	merged = append(merged, byte(ck))
+	merged = append(merged, childPrefix[:min(childPrefixLen, MAX_PREFIX_LEN)]...)
+	cin.prefix.Store(packPrefix(merged))
+	cin.prefixLen.Store(uint32(prefixLen + 1 + childPrefixLen))
+	child.unlock()
+	return child
+}
+
+// 乐观比较前缀，只比较存储的部分，返回前缀长度
+func (in *inner[V]) checkPrefix(key []byte, depth int) (int, bool) {
+	prefixLen := int(in.prefixLen.Load())
+	if depth+prefixLen > len(key) {
+		return prefixLen, false
+	}
+	stored := unpackPrefix(in.prefix.Load())
+	l := min(prefixLen, MAX_PREFIX_LEN)
+	return prefixLen, bytes.Equal(key[depth:depth+l], stored[:l])
+}
+
+// 完整前缀，超出存储长度的部分从子树中任一叶子节点的 key 获取
+// 存储的部分写入 buf 避免分配，ok 为 false 表示读到了不一致的节点，需重试
+func (n *node[V]) fullPrefix(depth int, buf *[MAX_PREFIX_LEN]byte) (prefix []byte, ok bool) {
+	in := n.asInner()
+	prefixLen := int(in.prefixLen.Load())
+	if prefixLen <= MAX_PREFIX_LEN {
+		*buf = unpackPrefix(in.prefix.Load())
+		return buf[:prefixLen], true
+	}
+	l, ok := n.minLeaf()
+	if !ok || l == nil || len(l.key) < depth+prefixLen {
+		return nil, false
+	}
+	return l.key[depth : depth+prefixLen], true
+}
+
+// 子树中最小的叶子节点，只有空的 root 没有叶子
+func (n *node[V]) minLeaf() (*leaf[V], bool) {
+	for !n.isLeaf() {
+		v, ok := n.readLock()
+		if !ok {
+			return nil, false
+		}
+		next := n.asInner().leaf.Load()
+		if next == nil {
+			_, next = n.childGE(0)
+		}
+		if !n.check(v) {
+			return nil, false
+		}
+		if next == nil {
+			return nil, true
+		}
+		n = next
+	}
+	return n.asLeaf(), true
+}
+
+// 子树中最大的叶子节点
+func (n *node[V]) maxLeaf() (*leaf[V], bool) {
+	for !n.isLeaf() {
+		v, ok := n.readLock()
+		if !ok {
+			return nil, false
+		}
+		_, next := n.childLE(MAX_NODE256 - 1)
+		if next == nil {
+			next = n.asInner().leaf.Load()
+		}
+		if !n.check(v) {
+			return nil, false
+		}
+		if next == nil {
+			return nil, true
+		}
+		n = next
+	}
+	return n.asLeaf(), true
+}
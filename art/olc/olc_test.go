@@ -0,0 +1,307 @@
+package olc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+	"trees"
+	"trees/conformance"
+)
+
+//
+// 功能 case
+//
+func TestBasic(t *testing.T) {
+	t1 := New[string]()
+	t1.Insert([]byte("ab"), "AB")
+	assert.Equal(t, t1.Size(), 1)
+	assert.Equal(t, t1.Search([]byte("ab")), "AB")
+
+	// 叶子分裂
+	t1.Insert([]byte("abc"), "ABC")
+	t1.Insert([]byte("abd"), "ABD")
+	child := t1.root.findChild('a')
+	assert.Equal(t, child.nodeType, NODE4)
+	assert.Equal(t, child.asInner().prefixLen.Load(), uint32(1))
+	assert.Equal(t, child.asInner().leaf.Load().asLeaf().key, []byte("ab"))
+
+	// 前缀分裂
+	t1.Insert([]byte("a"), "A")
+	child = t1.root.findChild('a')
+	assert.Equal(t, child.asInner().prefixLen.Load(), uint32(0))
+	assert.Equal(t, child.asInner().leaf.Load().asLeaf().key, []byte("a"))
+
+	// 更新替换叶子节点
+	old, replaced := t1.Put([]byte("abc"), "abc")
+	assert.True(t, replaced)
+	assert.Equal(t, old, "ABC")
+	existing, loaded := t1.PutIfAbsent([]byte("abc"), "-")
+	assert.True(t, loaded)
+	assert.Equal(t, existing, "abc")
+
+	// 删除后 NODE4 合并到唯一的子节点
+	t1.Delete([]byte("a"))
+	t1.Delete([]byte("abd"))
+	child = t1.root.findChild('a')
+	assert.Equal(t, child.nodeType, NODE4)
+	assert.Equal(t, child.asInner().prefixLen.Load(), uint32(1))
+	t1.Delete([]byte("ab"))
+	assert.True(t, t1.root.findChild('a').isLeaf())
+	assert.Equal(t, t1.Dump(), map[string]string{"abc": "abc"})
+}
+
+// 节点逐级扩容到 NODE256 再逐级收缩，每一步都替换为新节点，旧节点被标记为废弃
+func TestNodeReplace(t *testing.T) {
+	t1 := New[int]()
+	key := func(i int) []byte { return []byte{'k', byte(i)} }
+	var olds []*node[int]
+	for i := 0; i < 256; i++ {
+		t1.Insert(key(i), i)
+		n := t1.root.findChild('k')
+		switch i + 1 {
+		case 2, MAX_NODE4, MAX_NODE16, MAX_NODE48:
+			olds = append(olds, n)
+		case MAX_NODE4 + 1, MAX_NODE16 + 1, MAX_NODE48 + 1:
+			assert.True(t, olds[len(olds)-1].version.Load()&obsoleteBit != 0)
+		}
+	}
+	n := t1.root.findChild('k')
+	assert.Equal(t, n.nodeType, NODE256)
+	assert.Equal(t, n.asInner().size.Load(), uint32(256))
+
+	for i := 255; i >= 1; i-- {
+		t1.Delete(key(i))
+		n = t1.root.findChild('k')
+		switch {
+		case i >= MIN_NODE256:
+			assert.Equal(t, n.nodeType, NODE256)
+		case i >= MIN_NODE48:
+			assert.Equal(t, n.nodeType, NODE48)
+		case i >= MIN_NODE16:
+			assert.Equal(t, n.nodeType, NODE16)
+		case i >= MIN_NODE4:
+			assert.Equal(t, n.nodeType, NODE4)
+		default:
+			assert.True(t, n.isLeaf())
+		}
+		v, ok := t1.Get(key(0))
+		assert.True(t, ok)
+		assert.Equal(t, v, 0)
+	}
+	assert.Equal(t, t1.Size(), 1)
+}
+
+// 合并时前缀超过存储长度，存储的部分由父节点前缀、key 和子节点前缀拼接
+func TestCollapseLongPrefix(t *testing.T) {
+	t1 := New[int]()
+	long := bytes.Repeat([]byte("p"), 12)
+	keys := [][]byte{
+		append(append([]byte("a"), long...), "x1"...),
+		append(append([]byte("a"), long...), "x2"...),
+		append(append([]byte("a"), long...), 'y'),
+		[]byte("ab"),
+	}
+	for i, k := range keys {
+		t1.Insert(k, i)
+	}
+	t1.Delete(keys[2])
+	t1.Delete(keys[3])
+	n := t1.root.findChild('a')
+	assert.Equal(t, n.asInner().prefixLen.Load(), uint32(len(long)+1))
+	assert.Equal(t, unpackPrefix(n.asInner().prefix.Load()), [MAX_PREFIX_LEN]byte([]byte("pppppppp")))
+	for i, k := range keys[:2] {
+		v, ok := t1.Get(k)
+		assert.True(t, ok)
+		assert.Equal(t, v, i)
+	}
+	k, _ := t1.Ceiling(append(append([]byte("a"), long...), 'x'))
+	assert.Equal(t, k, keys[0])
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func() trees.IndexTree { return NewArtTree() })
+}
+
+func FuzzConformance(f *testing.F) {
+	conformance.Fuzz(f, func() trees.IndexTree { return NewArtTree() })
+}
+
+//
+// 并发 case，需配合 go test -race
+//
+// 多个写者交错地写入同一批节点，各自只负责 key 编号模 writers 余 w 的 key，结束后逐个校验
+// 预先写入的 stable key 不会被修改：读者期间必须总能查到，扫描时必须总能完整、有序地遍历到
+func TestConcurrent(t *testing.T) {
+	const (
+		writers  = 4
+		readers  = 2
+		scanners = 2
+		n        = 2000
+		stable   = 200
+		ops      = 20000
+	)
+	if testing.Short() {
+		t.Skip()
+	}
+	tree := New[int]()
+	key := func(i int) []byte {
+		// 共享前缀使各个写者竞争同一批节点，长短不一的后缀覆盖叶子分裂、前缀分裂和节点合并
+		k := binary.BigEndian.AppendUint16([]byte("user/"), uint16(i))
+		return append(k, bytes.Repeat([]byte{'x'}, i%11)...)
+	}
+	stableKey := func(i int) []byte { return []byte(fmt.Sprintf("user/stable/%04d", i)) }
+	for i := 0; i < stable; i++ {
+		tree.Insert(stableKey(i), -i)
+	}
+
+	models := make([]map[int]int, writers)
+	var wg sync.WaitGroup
+	var done sync.WaitGroup
+	stop := make(chan struct{})
+	for w := 0; w < writers; w++ {
+		models[w] = make(map[int]int)
+		wg.Add(1)
+		go func(w int, model map[int]int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			for op := 0; op < ops; op++ {
+				i := r.Intn(n/writers)*writers + w
+				k := key(i)
+				switch r.Intn(4) {
+				case 0, 1:
+					old, replaced := tree.Put(k, op)
+					want, ok := model[i]
+					assert.Equal(t, replaced, ok)
+					assert.Equal(t, old, want)
+					model[i] = op
+				case 2:
+					old, ok := tree.Delete(k)
+					want, exists := model[i]
+					assert.Equal(t, ok, exists)
+					assert.Equal(t, old, want)
+					delete(model, i)
+				case 3:
+					v, ok := tree.Get(k)
+					want, exists := model[i]
+					assert.Equal(t, ok, exists)
+					assert.Equal(t, v, want)
+				}
+			}
+		}(w, models[w])
+	}
+
+	for g := 0; g < readers; g++ {
+		done.Add(1)
+		go func(g int) {
+			defer done.Done()
+			r := rand.New(rand.NewSource(int64(100 + g)))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				i := r.Intn(stable)
+				v, ok := tree.Get(stableKey(i))
+				assert.True(t, ok)
+				assert.Equal(t, v, -i)
+				runtime.Gosched()
+			}
+		}(g)
+	}
+
+	for g := 0; g < scanners; g++ {
+		done.Add(1)
+		go func(g int) {
+			defer done.Done()
+			for round := 0; ; round++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				var prev []byte
+				cnt := 0
+				scan := tree.All()
+				if round%2 == 1 {
+					scan = tree.Backward()
+				}
+				for k := range scan {
+					if prev != nil {
+						c := bytes.Compare(prev, k)
+						assert.True(t, c < 0 == (round%2 == 0) && c != 0, "scan out of order: %q %q", prev, k)
+					}
+					if bytes.HasPrefix(k, []byte("user/stable/")) {
+						cnt++
+					}
+					prev = k
+				}
+				assert.Equal(t, cnt, stable)
+				assert.Equal(t, tree.CountPrefix([]byte("user/stable/")), stable)
+			}
+		}(g)
+	}
+
+	wg.Wait()
+	close(stop)
+	done.Wait()
+
+	want := make(map[string]int)
+	for i := 0; i < stable; i++ {
+		want[string(stableKey(i))] = -i
+	}
+	for _, model := range models {
+		for i, v := range model {
+			want[string(key(i))] = v
+		}
+	}
+	assert.Equal(t, tree.Dump(), want)
+	assert.Equal(t, tree.Size(), len(want))
+}
+
+// 并发 PopMin 每个 key 恰好被弹出一次
+func TestConcurrentPop(t *testing.T) {
+	const n, workers = 4000, 4
+	tree := New[int]()
+	for i := 0; i < n; i++ {
+		tree.Insert(binary.BigEndian.AppendUint32(nil, uint32(i)), i)
+	}
+	popped := make([][]int, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for {
+				pop := tree.PopMin
+				if w%2 == 1 {
+					pop = tree.PopMax
+				}
+				k, v := pop()
+				if k == nil {
+					return
+				}
+				assert.Equal(t, int(binary.BigEndian.Uint32(k)), v)
+				popped[w] = append(popped[w], v)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make([]bool, n)
+	for _, vs := range popped {
+		for _, v := range vs {
+			assert.False(t, seen[v])
+			seen[v] = true
+		}
+	}
+	for i := range seen {
+		assert.True(t, seen[i])
+	}
+	assert.Equal(t, tree.Size(), 0)
+}
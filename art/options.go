@@ -0,0 +1,51 @@
+package art
+
+import "fmt"
+
+// 树的可选配置，通过 New / NewArtTree 的 opts 传入
+type Option func(*options)
+
+type options struct {
+	prefixLen        int  // 节点中存储并悲观比较的前缀长度
+	shrinkHysteresis int  // 节点收缩的滞后量
+	zeroCopyKeys     bool // 叶子节点直接引用调用方的 key
+}
+
+func defaultOptions() options {
+	return options{
+		prefixLen:        MAX_PREFIX_LEN,
+		shrinkHysteresis: 0,
+		zeroCopyKeys:     false,
+	}
+}
+
+// 节点中存储的前缀长度，取值 [0, MAX_PREFIX_LEN]，默认 MAX_PREFIX_LEN
+// 前缀不超过 n 时为悲观模式，逐字节比较；超过 n 则为乐观模式，查找时跳过剩余部分，由叶子节点校验完整 key
+// n 越小下沉时比较的字节越少，n 越大越早发现不匹配的 key，节点占用的空间不变
+func WithPrefixLen(n int) Option {
+	if n < 0 || n > MAX_PREFIX_LEN {
+		panic(fmt.Sprintf("art: prefix len %d out of range [0, %d]", n, MAX_PREFIX_LEN))
+	}
+	return func(o *options) {
+		o.prefixLen = n
+	}
+}
+
+// 节点收缩的滞后量，取值 [0, MIN_NODE16-2]，默认 0
+// NODE16、NODE48、NODE256 的子节点数降到 MIN_* - n 以下才收缩，避免在 NODE4/NODE16 等边界交替增删时反复膨胀和收缩
+func WithShrinkHysteresis(n int) Option {
+	if n < 0 || n > MIN_NODE16-2 {
+		panic(fmt.Sprintf("art: shrink hysteresis %d out of range [0, %d]", n, MIN_NODE16-2))
+	}
+	return func(o *options) {
+		o.shrinkHysteresis = n
+	}
+}
+
+// 叶子节点直接引用调用方传入的 key，不再拷贝
+// 调用方需保证 key 在写入后不再被修改，否则树的结构会被破坏
+func WithZeroCopyKeys() Option {
+	return func(o *options) {
+		o.zeroCopyKeys = true
+	}
+}
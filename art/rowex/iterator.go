@@ -0,0 +1,315 @@
+package rowex
+
+import (
+	"bytes"
+	"iter"
+	"trees"
+)
+
+var _ trees.Tree[int] = (*Tree[int])(nil)
+var _ trees.IndexTree = (*ArtTree)(nil)
+
+// 有序双向迭代器，可以与写者并发使用
+// 只记录当前所在的叶子节点，每次移动都从 root 重新查找当前 key 的后继或前驱，与 Get 一样不加锁也不重试
+type Iterator[V any] struct {
+	tree *Tree[V]
+	leaf *leaf[V]
+}
+
+func (t *Tree[V]) Iterator() trees.Cursor[V] {
+	return &Iterator[V]{tree: t}
+}
+
+// 升序遍历
+func (t *Tree[V]) All() iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		it := &Iterator[V]{tree: t}
+		for ok := it.SeekToFirst(); ok; ok = it.Next() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// 降序遍历
+func (t *Tree[V]) Backward() iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		it := &Iterator[V]{tree: t}
+		for ok := it.SeekToLast(); ok; ok = it.Prev() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+func (it *Iterator[V]) SeekToFirst() bool {
+	it.leaf = it.tree.ceiling(nil, true)
+	return it.Valid()
+}
+
+func (it *Iterator[V]) SeekToLast() bool {
+	it.leaf = it.tree.last()
+	return it.Valid()
+}
+
+// 定位到第一个 >= key 的叶子节点
+func (it *Iterator[V]) Seek(key []byte) bool {
+	it.leaf = it.tree.ceiling(key, true)
+	return it.Valid()
+}
+
+// 定位到最后一个 <= key 的叶子节点
+func (it *Iterator[V]) SeekForPrev(key []byte) bool {
+	it.leaf = it.tree.floor(key, true)
+	return it.Valid()
+}
+
+func (it *Iterator[V]) Next() bool {
+	if !it.Valid() {
+		return false
+	}
+	it.leaf = it.tree.ceiling(it.leaf.key, false)
+	return it.Valid()
+}
+
+func (it *Iterator[V]) Prev() bool {
+	if !it.Valid() {
+		return false
+	}
+	it.leaf = it.tree.floor(it.leaf.key, false)
+	return it.Valid()
+}
+
+func (it *Iterator[V]) Valid() bool {
+	return it.leaf != nil
+}
+
+func (it *Iterator[V]) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.leaf.key
+}
+
+func (it *Iterator[V]) Value() (v V) {
+	if !it.Valid() {
+		return v
+	}
+	return it.leaf.val
+}
+
+// 第一个 >= key 的叶子节点，inclusive 为 false 时为第一个 > key 的叶子节点
+func (t *Tree[V]) ceiling(key []byte, inclusive bool) *leaf[V] {
+	return t.ge(t.root, 0, key, inclusive)
+}
+
+// 最后一个 <= key 的叶子节点，inclusive 为 false 时为最后一个 < key 的叶子节点
+func (t *Tree[V]) floor(key []byte, inclusive bool) *leaf[V] {
+	return t.le(t.root, 0, key, inclusive)
+}
+
+func (t *Tree[V]) last() *leaf[V] {
+	return t.root.maxLeaf()
+}
+
+// 与 key 比较子树 n 的完整路径在 [depth, level) 的部分，c < 0 表示整棵子树都大于 key，c > 0 表示都小于 key
+// 子树中所有叶子节点都以 n 的完整路径为前缀，且路径永远不变，取任一叶子节点比较即可
+func (n *node[V]) comparePath(key []byte, depth int) int {
+	level := n.level()
+	if level == depth {
+		return 0
+	}
+	l := n.minLeaf()
+	if l == nil {
+		return 1 // 空的 root
+	}
+	end := min(len(key), level)
+	c := bytes.Compare(key[depth:end], l.key[depth:end])
+	if c == 0 && end < level {
+		c = -1 // key 在前缀内结束，是整棵子树的前缀
+	}
+	return c
+}
+
+// 子树 n 中第一个 >= key 的叶子节点，depth 为 n 的父节点 level + 1，沿 key 下沉，子树中没有则取下一个兄弟子树的最小叶子
+func (t *Tree[V]) ge(n *node[V], depth int, key []byte, inclusive bool) *leaf[V] {
+	switch c := n.comparePath(key, depth); {
+	case c < 0:
+		return n.minLeaf()
+	case c > 0:
+		return nil
+	}
+
+	// n.leaf 恰好等于 key，其余子节点都大于 key
+	level := n.level()
+	if level == len(key) {
+		next := n.asInner().leaf.Load()
+		if next == nil || !inclusive {
+			_, next = n.childGE(0)
+		}
+		if next == nil {
+			return nil
+		}
+		return next.minLeaf()
+	}
+
+	k := int(key[level])
+	if child := n.findChild(key[level]); child != nil {
+		if child.isLeaf() {
+			l := child.asLeaf()
+			if c := bytes.Compare(l.key, key); c > 0 || c == 0 && inclusive {
+				return l
+			}
+		} else if l := t.ge(child, level+1, key, inclusive); l != nil {
+			return l
+		}
+	}
+	_, next := n.childGE(k + 1)
+	if next == nil {
+		return nil
+	}
+	return next.minLeaf()
+}
+
+// 子树 n 中最后一个 <= key 的叶子节点，子树中没有则取上一个兄弟子树的最大叶子，再没有则取 n.leaf
+func (t *Tree[V]) le(n *node[V], depth int, key []byte, inclusive bool) *leaf[V] {
+	switch c := n.comparePath(key, depth); {
+	case c < 0:
+		return nil
+	case c > 0:
+		return n.maxLeaf()
+	}
+
+	// 只有 n.leaf 可能等于 key，其余子节点都大于 key
+	in := n.asInner()
+	level := n.level()
+	if level == len(key) {
+		if next := in.leaf.Load(); next != nil && inclusive {
+			return next.asLeaf()
+		}
+		return nil
+	}
+
+	k := int(key[level])
+	if child := n.findChild(key[level]); child != nil {
+		if child.isLeaf() {
+			l := child.asLeaf()
+			if c := bytes.Compare(l.key, key); c < 0 || c == 0 && inclusive {
+				return l
+			}
+		} else if l := t.le(child, level+1, key, inclusive); l != nil {
+			return l
+		}
+	}
+	_, next := n.childLE(k - 1)
+	if next == nil {
+		next = in.leaf.Load() // 比 key 短的前缀，小于 key
+	}
+	if next == nil {
+		return nil
+	}
+	return next.maxLeaf()
+}
+
+// 最小 key，空树则 k 为 nil
+func (t *Tree[V]) Min() (k []byte, v V) {
+	return t.result(t.ceiling(nil, true))
+}
+
+// 最大 key，空树则 k 为 nil
+func (t *Tree[V]) Max() (k []byte, v V) {
+	return t.result(t.last())
+}
+
+// 最后一个 <= key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Floor(key []byte) (k []byte, v V) {
+	return t.result(t.floor(key, true))
+}
+
+// 第一个 >= key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Ceiling(key []byte) (k []byte, v V) {
+	return t.result(t.ceiling(key, true))
+}
+
+// 最后一个 < key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Lower(key []byte) (k []byte, v V) {
+	return t.result(t.floor(key, false))
+}
+
+// 第一个 > key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Higher(key []byte) (k []byte, v V) {
+	return t.result(t.ceiling(key, false))
+}
+
+// 叶子节点不会被修改，其 key 可以直接返回给调用方
+func (t *Tree[V]) result(l *leaf[V]) (k []byte, v V) {
+	if l == nil {
+		return nil, v
+	}
+	return l.key, l.val
+}
+
+// 删除并返回最小 key，空树则 k 为 nil
+// 查找与删除之间其它 goroutine 可能写入更小的 key；最小 key 先被其它 goroutine 删除则重新查找
+func (t *Tree[V]) PopMin() (k []byte, v V) {
+	for {
+		if k, _ = t.Min(); k == nil {
+			return nil, v
+		}
+		if v, ok := t.Delete(k); ok {
+			return k, v
+		}
+	}
+}
+
+// 删除并返回最大 key，空树则 k 为 nil
+func (t *Tree[V]) PopMax() (k []byte, v V) {
+	for {
+		if k, _ = t.Max(); k == nil {
+			return nil, v
+		}
+		if v, ok := t.Delete(k); ok {
+			return k, v
+		}
+	}
+}
+
+// 升序遍历 [start, end) 内的 key，start 为 nil 则从最小 key 开始，end 为 nil 则遍历到最大 key
+// fn 返回 false 则提前结束
+func (t *Tree[V]) Range(start, end []byte, fn func(k []byte, v V) bool) {
+	it := &Iterator[V]{tree: t}
+	for ok := it.Seek(start); ok; ok = it.Next() {
+		if end != nil && bytes.Compare(it.Key(), end) >= 0 {
+			return
+		}
+		if !fn(it.Key(), it.Value()) {
+			return
+		}
+	}
+}
+
+// 升序遍历所有以 prefix 为前缀的 key，fn 返回 false 则提前结束
+func (t *Tree[V]) WalkPrefix(prefix []byte, fn func(k []byte, v V) bool) {
+	it := &Iterator[V]{tree: t}
+	for ok := it.Seek(prefix); ok && bytes.HasPrefix(it.Key(), prefix); ok = it.Next() {
+		if !fn(it.Key(), it.Value()) {
+			return
+		}
+	}
+}
+
+func (t *Tree[V]) HasPrefix(prefix []byte) bool {
+	l := t.ceiling(prefix, true)
+	return l != nil && bytes.HasPrefix(l.key, prefix)
+}
+
+func (t *Tree[V]) CountPrefix(prefix []byte) int {
+	cnt := 0
+	t.WalkPrefix(prefix, func([]byte, V) bool {
+		cnt++
+		return true
+	})
+	return cnt
+}
@@ -0,0 +1,56 @@
+package rowex
+
+import "runtime"
+
+// 节点的版本锁，只在写者之间互斥，读者从不读取
+// version 的最低位标记节点已废弃，次低位标记已加写锁，其余位为版本号
+// 写者下沉时记录版本号，修改前将其 CAS 升级为写锁，期间节点被其它写者修改或替换则从 root 重试
+const (
+	obsoleteBit = 1
+	lockedBit   = 2
+)
+
+// 等待其它写者释放锁后返回版本号，节点已废弃则返回 false，调用方需重试
+func (n *node[V]) readLock() (uint64, bool) {
+	for {
+		v := n.version.Load()
+		if v&lockedBit != 0 {
+			runtime.Gosched()
+			continue
+		}
+		return v, v&obsoleteBit == 0
+	}
+}
+
+// 校验节点未被其它写者修改
+func (n *node[V]) check(v uint64) bool {
+	return n.version.Load() == v
+}
+
+// 将读取时的版本号升级为写锁，期间节点被修改过则失败
+func (n *node[V]) upgrade(v uint64) bool {
+	return n.version.CompareAndSwap(v, v+lockedBit)
+}
+
+// 直接加写锁，节点已废弃则失败
+func (n *node[V]) writeLock() bool {
+	for {
+		v, ok := n.readLock()
+		if !ok {
+			return false
+		}
+		if n.upgrade(v) {
+			return true
+		}
+	}
+}
+
+// 释放写锁，锁位进位到版本号
+func (n *node[V]) unlock() {
+	n.version.Add(lockedBit)
+}
+
+// 释放写锁并标记节点已废弃，节点已从树中摘除，但内容保持不变，仍在其中的读者可以继续读取
+func (n *node[V]) unlockObsolete() {
+	n.version.Add(lockedBit + obsoleteBit)
+}
@@ -0,0 +1,486 @@
+package rowex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync/atomic"
+	"unsafe"
+)
+
+type nodeType uint8
+
+const (
+	NODE4 nodeType = iota
+	NODE16
+	NODE48
+	NODE256
+	LEAF
+)
+
+// 与 art 包相同，收缩下限比下一级节点的膨胀上限多 1
+const (
+	MIN_NODE4 = 2
+	MAX_NODE4 = 4
+
+	MIN_NODE16 = 5
+	MAX_NODE16 = 16
+
+	MIN_NODE48 = 17
+	MAX_NODE48 = 48
+
+	MIN_NODE256 = 49
+	MAX_NODE256 = 256
+
+	MAX_PREFIX_LEN = 4 // 前缀长度和前 4 字节前缀打包为一个 uint64，原子地整体更新
+)
+
+// 所有节点的公共头部，version 为写者之间的版本锁，见 lock.go
+// 读者不加锁、不重试，写者对节点的每次原地修改都是单个原子写，读者在任意时刻看到的节点都是一致的：
+//   - 添加子节点时先写 child 再写 key，最后递增 used 使其可见
+//   - 槽位只追加不复用，删除只清空 child，读者不会把旧 key 对应到新的 child 上
+//   - 需要重新排布的修改（扩容、压缩、收缩）拷贝出新节点，原子地替换父节点中的指针，旧节点不再修改
+type node[V any] struct {
+	version  atomic.Uint64
+	nodeType nodeType
+}
+
+// level 为节点分派子节点所用 key 的下标，即从 root 到该节点的完整路径长度
+// 分裂和合并只在节点上方插入或摘除节点，节点的 level 和完整路径永远不变
+// 读者以 level 为锚点比较前缀，不依赖下沉时累加的深度，因此看到新旧前缀都能得到正确的结果
+type inner[V any] struct {
+	node[V]
+	level  uint32
+	prefix atomic.Uint64           // 高 32 位为前缀长度，低 32 位为前 MAX_PREFIX_LEN 字节前缀
+	size   atomic.Uint32           // 有效子节点数
+	used   atomic.Uint32           // NODE4、NODE16、NODE48 已追加的槽位数，含已删除的槽位
+	leaf   atomic.Pointer[node[V]] // 恰好在前缀处结束的 key
+}
+
+// NODE4 和 NODE16 的 keys 按追加顺序排列，每 8 个 key 按小端序打包为一个 uint64
+type node4[V any] struct {
+	inner[V]
+	keys   [1]atomic.Uint64
+	childs [MAX_NODE4]atomic.Pointer[node[V]]
+}
+
+type node16[V any] struct {
+	inner[V]
+	keys   [2]atomic.Uint64
+	childs [MAX_NODE16]atomic.Pointer[node[V]]
+}
+
+// index 以 key 为下标记录 childs 的索引 +1，0 表示不存在，每 8 个索引打包为一个 uint64
+type node48[V any] struct {
+	inner[V]
+	index  [32]atomic.Uint64
+	childs [MAX_NODE48]atomic.Pointer[node[V]]
+}
+
+type node256[V any] struct {
+	inner[V]
+	childs [MAX_NODE256]atomic.Pointer[node[V]]
+}
+
+// 叶子节点创建后不再修改，更新值时整体替换
+type leaf[V any] struct {
+	node[V]
+	key []byte
+	val V
+}
+
+func newNode4[V any](level int) *node4[V] {
+	n := &node4[V]{}
+	n.nodeType = NODE4
+	n.level = uint32(level)
+	return n
+}
+
+func newNode16[V any](level int) *node16[V] {
+	n := &node16[V]{}
+	n.nodeType = NODE16
+	n.level = uint32(level)
+	return n
+}
+
+func newNode48[V any](level int) *node48[V] {
+	n := &node48[V]{}
+	n.nodeType = NODE48
+	n.level = uint32(level)
+	return n
+}
+
+func newNode256[V any](level int) *node256[V] {
+	n := &node256[V]{}
+	n.nodeType = NODE256
+	n.level = uint32(level)
+	return n
+}
+
+func newLeaf[V any](key []byte, val V) *node[V] {
+	l := &leaf[V]{key: key, val: val}
+	l.nodeType = LEAF
+	return &l.node
+}
+
+func (n *node[V]) isLeaf() bool {
+	return n.nodeType == LEAF
+}
+
+func (n *node[V]) asLeaf() *leaf[V]       { return (*leaf[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asInner() *inner[V]     { return (*inner[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asNode4() *node4[V]     { return (*node4[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asNode16() *node16[V]   { return (*node16[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asNode48() *node48[V]   { return (*node48[V])(unsafe.Pointer(n)) }
+func (n *node[V]) asNode256() *node256[V] { return (*node256[V])(unsafe.Pointer(n)) }
+
+func (n *node[V]) maxSize() int {
+	switch n.nodeType {
+	case NODE4:
+		return MAX_NODE4
+	case NODE16:
+		return MAX_NODE16
+	case NODE48:
+		return MAX_NODE48
+	}
+	return MAX_NODE256
+}
+
+func (n *node[V]) minSize() int {
+	switch n.nodeType {
+	case NODE4:
+		return MIN_NODE4
+	case NODE16:
+		return MIN_NODE16
+	case NODE48:
+		return MIN_NODE48
+	}
+	return MIN_NODE256
+}
+
+// 槽位已用尽，NODE256 每个 key 都有固定的槽位，永远不满
+func (n *node[V]) isFull() bool {
+	return n.nodeType != NODE256 && int(n.asInner().used.Load()) == n.maxSize()
+}
+
+func (n *node[V]) level() int {
+	return int(n.asInner().level)
+}
+
+// 前缀长度和存储部分的打包和解包
+func packPrefix(prefixLen int, prefix []byte) uint64 {
+	var buf [8]byte
+	copy(buf[:MAX_PREFIX_LEN], prefix)
+	return uint64(prefixLen)<<32 | uint64(binary.LittleEndian.Uint32(buf[:]))
+}
+
+func (in *inner[V]) loadPrefix() (prefixLen int, stored [MAX_PREFIX_LEN]byte) {
+	w := in.prefix.Load()
+	binary.LittleEndian.PutUint32(stored[:], uint32(w))
+	return int(w >> 32), stored
+}
+
+// NODE4 和 NODE16 的 keys 和 childs
+func (n *node[V]) slots() ([]atomic.Uint64, []atomic.Pointer[node[V]]) {
+	if n.nodeType == NODE4 {
+		n4 := n.asNode4()
+		return n4.keys[:], n4.childs[:]
+	}
+	n16 := n.asNode16()
+	return n16.keys[:], n16.childs[:]
+}
+
+func loadKeys(words []atomic.Uint64) (keys [MAX_NODE16]byte) {
+	for i := range words {
+		binary.LittleEndian.PutUint64(keys[i*8:], words[i].Load())
+	}
+	return keys
+}
+
+// NODE48 中 key 对应的 childs 索引 +1
+func (n *node48[V]) childIndex(k byte) int {
+	return int(byte(n.index[k/8].Load() >> (k % 8 * 8)))
+}
+
+func (n *node48[V]) setChildIndex(k byte, i int) {
+	w := &n.index[k/8]
+	shift := k % 8 * 8
+	w.Store(w.Load()&^(0xff<<shift) | uint64(i)<<shift)
+}
+
+// 查找 key 为 k 的子节点，不存在返回 nil
+func (n *node[V]) findChild(k byte) *node[V] {
+	if ref := n.childRef(k); ref != nil {
+		return ref.Load()
+	}
+	return nil
+}
+
+// key 为 k 的有效子节点槽位，不存在返回 nil
+// 同一个 key 删除后再添加会追加到新的槽位，查找时需跳过已清空的旧槽位
+func (n *node[V]) childRef(k byte) *atomic.Pointer[node[V]] {
+	switch n.nodeType {
+	case NODE4, NODE16:
+		words, childs := n.slots()
+		used := int(n.asInner().used.Load())
+		keys := loadKeys(words)
+		for i := 0; i < used; i++ {
+			if keys[i] == k && childs[i].Load() != nil {
+				return &childs[i]
+			}
+		}
+	case NODE48:
+		n48 := n.asNode48()
+		if i := n48.childIndex(k); i > 0 && n48.childs[i-1].Load() != nil {
+			return &n48.childs[i-1]
+		}
+	case NODE256:
+		if ref := &n.asNode256().childs[k]; ref.Load() != nil {
+			return ref
+		}
+	}
+	return nil
+}
+
+// 第一个 key >= k 的子节点，不存在返回 nil
+// NODE4 和 NODE16 的 keys 无序，需扫描全部槽位
+func (n *node[V]) childGE(k int) (int, *node[V]) {
+	switch n.nodeType {
+	case NODE4, NODE16:
+		words, childs := n.slots()
+		used := int(n.asInner().used.Load())
+		keys := loadKeys(words)
+		best, bestChild := -1, (*node[V])(nil)
+		for i := 0; i < used; i++ {
+			if key := int(keys[i]); key >= k && (best < 0 || key < best) {
+				if child := childs[i].Load(); child != nil {
+					best, bestChild = key, child
+				}
+			}
+		}
+		return best, bestChild
+	case NODE48:
+		n48 := n.asNode48()
+		for ; k < MAX_NODE256; k++ {
+			if i := n48.childIndex(byte(k)); i > 0 {
+				if child := n48.childs[i-1].Load(); child != nil {
+					return k, child
+				}
+			}
+		}
+	case NODE256:
+		n256 := n.asNode256()
+		for ; k < MAX_NODE256; k++ {
+			if child := n256.childs[k].Load(); child != nil {
+				return k, child
+			}
+		}
+	}
+	return -1, nil
+}
+
+// 最后一个 key <= k 的子节点，不存在返回 nil
+func (n *node[V]) childLE(k int) (int, *node[V]) {
+	switch n.nodeType {
+	case NODE4, NODE16:
+		words, childs := n.slots()
+		used := int(n.asInner().used.Load())
+		keys := loadKeys(words)
+		best, bestChild := -1, (*node[V])(nil)
+		for i := 0; i < used; i++ {
+			if key := int(keys[i]); key <= k && key > best {
+				if child := childs[i].Load(); child != nil {
+					best, bestChild = key, child
+				}
+			}
+		}
+		return best, bestChild
+	case NODE48:
+		n48 := n.asNode48()
+		for ; k >= 0; k-- {
+			if i := n48.childIndex(byte(k)); i > 0 {
+				if child := n48.childs[i-1].Load(); child != nil {
+					return k, child
+				}
+			}
+		}
+	case NODE256:
+		n256 := n.asNode256()
+		for ; k >= 0; k-- {
+			if child := n256.childs[k].Load(); child != nil {
+				return k, child
+			}
+		}
+	}
+	return -1, nil
+}
+
+// 子树中最小的叶子节点，只有空的 root 没有叶子
+func (n *node[V]) minLeaf() *leaf[V] {
+	for n != nil && !n.isLeaf() {
+		next := n.asInner().leaf.Load()
+		if next == nil {
+			_, next = n.childGE(0)
+		}
+		n = next
+	}
+	if n == nil {
+		return nil
+	}
+	return n.asLeaf()
+}
+
+// 子树中最大的叶子节点
+func (n *node[V]) maxLeaf() *leaf[V] {
+	for n != nil && !n.isLeaf() {
+		_, next := n.childLE(MAX_NODE256 - 1)
+		if next == nil {
+			next = n.asInner().leaf.Load()
+		}
+		n = next
+	}
+	if n == nil {
+		return nil
+	}
+	return n.asLeaf()
+}
+
+// 乐观比较前缀，只比较存储的部分，完整的 key 由叶子节点校验
+func (in *inner[V]) checkPrefix(key []byte) bool {
+	level := int(in.level)
+	if level > len(key) {
+		return false
+	}
+	prefixLen, stored := in.loadPrefix()
+	start := level - prefixLen
+	l := min(prefixLen, MAX_PREFIX_LEN)
+	return bytes.Equal(key[start:start+l], stored[:l])
+}
+
+// 完整前缀，即完整路径的 [level-prefixLen, level) 部分，超出存储长度的部分从子树中任一叶子节点获取
+// 存储的部分写入 buf 避免分配
+func (n *node[V]) fullPrefix(buf *[MAX_PREFIX_LEN]byte) []byte {
+	in := n.asInner()
+	prefixLen, stored := in.loadPrefix()
+	if prefixLen <= MAX_PREFIX_LEN {
+		*buf = stored
+		return buf[:prefixLen]
+	}
+	level := int(in.level)
+	return n.minLeaf().key[level-prefixLen : level]
+}
+
+// 以下方法只由持有写锁的写者，或尚未发布到树中的新节点调用
+
+// 追加子节点，调用方保证节点未满且 k 不存在
+func (n *node[V]) addChild(k byte, child *node[V]) {
+	in := n.asInner()
+	switch n.nodeType {
+	case NODE4, NODE16:
+		words, childs := n.slots()
+		pos := int(in.used.Load())
+		childs[pos].Store(child)
+		w := &words[pos/8]
+		shift := pos % 8 * 8
+		w.Store(w.Load()&^(0xff<<shift) | uint64(k)<<shift)
+		in.used.Store(uint32(pos + 1))
+	case NODE48:
+		n48 := n.asNode48()
+		pos := int(in.used.Load())
+		n48.childs[pos].Store(child)
+		n48.setChildIndex(k, pos+1)
+		in.used.Store(uint32(pos + 1))
+	case NODE256:
+		n.asNode256().childs[k].Store(child)
+	}
+	in.size.Add(1)
+}
+
+// 删除子节点，调用方保证 k 存在；只清空槽位，不移动其它子节点
+func (n *node[V]) removeChild(k byte) {
+	n.childRef(k).Store(nil)
+	n.asInner().size.Add(^uint32(0))
+}
+
+// 叶子节点的 key 在 level 处结束则存为 leaf，否则以 key[level] 添加为子节点
+func (n *node[V]) addLeaf(l *node[V]) {
+	level := n.level()
+	if key := l.asLeaf().key; len(key) == level {
+		n.asInner().leaf.Store(l)
+	} else {
+		n.addChild(key[level], l)
+	}
+}
+
+// 拷贝到新节点，跳过 key 为 skip 的子节点，skip 为 -1 则拷贝全部，新节点中的槽位按 key 有序且没有空洞
+func (n *node[V]) copyTo(dst *node[V], skip int) *node[V] {
+	in, din := n.asInner(), dst.asInner()
+	din.prefix.Store(in.prefix.Load())
+	din.leaf.Store(in.leaf.Load())
+	for k, child := n.childGE(0); child != nil; k, child = n.childGE(k + 1) {
+		if k != skip {
+			dst.addChild(byte(k), child)
+		}
+	}
+	return dst
+}
+
+// 槽位用尽时的替换节点：有效子节点未满则压缩为同类型的节点，否则扩容
+func (n *node[V]) grow() *node[V] {
+	level := n.level()
+	typ := n.nodeType
+	if int(n.asInner().size.Load()) == n.maxSize() {
+		typ++
+	}
+	switch typ {
+	case NODE4:
+		return n.copyTo(&newNode4[V](level).node, -1)
+	case NODE16:
+		return n.copyTo(&newNode16[V](level).node, -1)
+	case NODE48:
+		return n.copyTo(&newNode48[V](level).node, -1)
+	}
+	return n.copyTo(&newNode256[V](level).node, -1)
+}
+
+// 删除 k 后收缩为更小的节点
+func (n *node[V]) shrink(k byte) *node[V] {
+	level := n.level()
+	switch n.nodeType {
+	case NODE16:
+		return n.copyTo(&newNode4[V](level).node, int(k))
+	case NODE48:
+		return n.copyTo(&newNode16[V](level).node, int(k))
+	}
+	return n.copyTo(&newNode48[V](level).node, int(k))
+}
+
+// NODE4 删除后只剩一个 leaf 或子节点，返回用来替换 n 的节点
+// 剩下的是内部节点时锁住它，把 n 的前缀和它在 n 中的 key 合并到其前缀前面，加锁失败返回 nil
+// 子节点的 level 不变，读者无论从 n 还是从替换后的父节点进入子节点，前缀都能比较正确
+func (n *node[V]) collapse(atLeaf bool, k byte) *node[V] {
+	in := n.asInner()
+	if l := in.leaf.Load(); !atLeaf && l != nil {
+		return l
+	}
+	ck, child := n.childGE(0)
+	if !atLeaf && byte(ck) == k {
+		ck, child = n.childGE(ck + 1)
+	}
+	if child.isLeaf() {
+		return child
+	}
+	if !child.writeLock() {
+		return nil
+	}
+
+	cin := child.asInner()
+	prefixLen, prefix := in.loadPrefix()
+	childPrefixLen, childPrefix := cin.loadPrefix()
+	var buf [2*MAX_PREFIX_LEN + 1]byte
+	merged := append(buf[:0], prefix[:min(prefixLen, MAX_PREFIX_LEN)]...)
+	merged = append(merged, byte(ck))
+	merged = append(merged, childPrefix[:min(childPrefixLen, MAX_PREFIX_LEN)]...)
+	cin.prefix.Store(packPrefix(prefixLen+1+childPrefixLen, merged))
+	child.unlock()
+	return child
+}
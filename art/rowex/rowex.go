@@ -0,0 +1,366 @@
+// Package rowex 实现基于 ROWEX（Read-Optimized Write EXclusion）的并发自适应基数树
+// 参考 Leis et al. The ART of Practical Synchronization (DaMoN 2016)
+//
+// 读者既不加锁也不重试：写者对节点的每次修改都是单个原子写，读者在任意时刻看到的都是一致的节点，见 node.go
+// 写者之间用每个节点的版本锁互斥，只锁住要修改的节点，替换节点时连同父节点一起加锁，被其它写者抢先修改则从 root 重试
+// 被替换的节点标记为废弃但内容不变，仍在其中的读者读完后交给 GC 回收
+// 相比 olc，读者的延迟稳定，代价是写者需要保证修改顺序，且 NODE4、NODE16 的 keys 无序
+package rowex
+
+import (
+	"bytes"
+	"sync/atomic"
+	"trees/utils"
+)
+
+// 值类型为 V 的并发自适应基数树，所有方法都可以被多个 goroutine 并发调用
+type Tree[V any] struct {
+	root *node[V] // 固定为没有前缀的 NODE256，永远不满也不会被替换，写者总有父节点可以加锁
+	size atomic.Int64
+}
+
+// 兼容存储 interface{} 的旧版 API
+type ArtTree = Tree[interface{}]
+
+// 创建空树
+func New[V any]() *Tree[V] {
+	return &Tree[V]{root: &newNode256[V](0).node}
+}
+
+func NewArtTree() *ArtTree {
+	return New[interface{}]()
+}
+
+// 叶子节点创建后不再修改，总是拷贝 key
+func (t *Tree[V]) newLeaf(key []byte, val V) *node[V] {
+	return newLeaf(cp(key), val)
+}
+
+// 新增或更新，等价于忽略返回值的 Put
+func (t *Tree[V]) Insert(key []byte, val V) {
+	t.Put(key, val)
+}
+
+// 新增或更新，replaced 标识 key 是否已存在，old 为被覆盖的旧值
+func (t *Tree[V]) Put(key []byte, val V) (old V, replaced bool) {
+	return t.insert(key, val, true)
+}
+
+// 仅在 key 不存在时写入，loaded 标识 key 是否已存在，existing 为已存在的值
+func (t *Tree[V]) PutIfAbsent(key []byte, val V) (existing V, loaded bool) {
+	return t.insert(key, val, false)
+}
+
+func (t *Tree[V]) insert(key []byte, val V, overwrite bool) (old V, ok bool) {
+	for {
+		if old, ok, retry := t.tryInsert(key, val, overwrite); !retry {
+			return old, ok
+		}
+	}
+}
+
+// 从 root 下沉一次，retry 为 true 表示途中节点被其它写者修改，已释放所有锁，需从头重试
+// 写者沿用读到的版本号做乐观校验，与读者之间不需要任何同步
+func (t *Tree[V]) tryInsert(key []byte, val V, overwrite bool) (old V, ok, retry bool) {
+	var (
+		parent        *node[V]
+		parentVersion uint64
+		parentKey     byte
+	)
+	n := t.root
+	v, _ := n.readLock()
+	for {
+		// 1. 前缀不匹配，分裂出新的父节点，n 在新节点中的 key 为分裂点
+		// 先把新节点挂到父节点，再原子地截短 n 的前缀，n 的 level 不变，读者从新旧父节点进入 n 都能正确比较前缀
+		in := n.asInner()
+		level := int(in.level)
+		var buf [MAX_PREFIX_LEN]byte
+		prefix := n.fullPrefix(&buf)
+		start := level - len(prefix)
+		if start > len(key) {
+			return old, false, true // n 已被其它写者分裂，版本号必然已变化
+		}
+		diff := utils.LongestPrefix(prefix, key[start:])
+		if diff < len(prefix) {
+			if !parent.upgrade(parentVersion) {
+				return old, false, true
+			}
+			if !n.upgrade(v) {
+				parent.unlock()
+				return old, false, true
+			}
+			split := newNode4[V](start + diff)
+			split.prefix.Store(packPrefix(diff, prefix[:diff]))
+			split.addLeaf(t.newLeaf(key, val))
+			split.addChild(prefix[diff], n)
+			parent.childRef(parentKey).Store(&split.node)
+			in.prefix.Store(packPrefix(len(prefix)-diff-1, prefix[diff+1:]))
+			n.unlock()
+			parent.unlock()
+			t.size.Add(1)
+			return old, false, false
+		}
+
+		// 2. key 恰好在当前节点的前缀处结束，存为节点的 leaf
+		if level == len(key) {
+			if !n.upgrade(v) {
+				return old, false, true
+			}
+			if parent != nil && !parent.check(parentVersion) {
+				n.unlock()
+				return old, false, true
+			}
+			if l := in.leaf.Load(); l != nil {
+				old = l.asLeaf().val
+				if overwrite {
+					in.leaf.Store(t.newLeaf(key, val))
+				}
+				n.unlock()
+				return old, true, false
+			}
+			in.leaf.Store(t.newLeaf(key, val))
+			n.unlock()
+			t.size.Add(1)
+			return old, false, false
+		}
+
+		// 3. 子节点不存在，追加叶子节点；槽位已用尽则拷贝到压缩或扩容后的新节点，替换父节点中的旧节点
+		k := key[level]
+		next := n.findChild(k)
+		if !n.check(v) {
+			return old, false, true
+		}
+		if next == nil {
+			if n.isFull() {
+				if !parent.upgrade(parentVersion) {
+					return old, false, true
+				}
+				if !n.upgrade(v) {
+					parent.unlock()
+					return old, false, true
+				}
+				bigger := n.grow()
+				bigger.addChild(k, t.newLeaf(key, val))
+				parent.childRef(parentKey).Store(bigger)
+				n.unlockObsolete()
+				parent.unlock()
+			} else {
+				if !n.upgrade(v) {
+					return old, false, true
+				}
+				if parent != nil && !parent.check(parentVersion) {
+					n.unlock()
+					return old, false, true
+				}
+				n.addChild(k, t.newLeaf(key, val))
+				n.unlock()
+			}
+			t.size.Add(1)
+			return old, false, false
+		}
+		if parent != nil && !parent.check(parentVersion) {
+			return old, false, true
+		}
+
+		// 4. 子节点为叶子，key 已存在则替换为新叶子，否则分裂出公共前缀节点，构造完成后再原子地挂上去
+		if next.isLeaf() {
+			if !n.upgrade(v) {
+				return old, false, true
+			}
+			l := next.asLeaf()
+			if bytes.Equal(l.key, key) {
+				old = l.val
+				if overwrite {
+					n.childRef(k).Store(t.newLeaf(key, val))
+				}
+				n.unlock()
+				return old, true, false
+			}
+			commonLen := utils.LongestPrefix(l.key[level+1:], key[level+1:])
+			split := newNode4[V](level + 1 + commonLen)
+			split.prefix.Store(packPrefix(commonLen, key[level+1:level+1+commonLen]))
+			split.addLeaf(next)
+			split.addLeaf(t.newLeaf(key, val))
+			n.childRef(k).Store(&split.node)
+			n.unlock()
+			t.size.Add(1)
+			return old, false, false
+		}
+
+		// 5. 继续下沉
+		nv, valid := next.readLock()
+		if !valid || !n.check(v) {
+			return old, false, true
+		}
+		parent, parentVersion, parentKey = n, v, k
+		n, v = next, nv
+	}
+}
+
+// 查找 key，不存在则返回 V 的零值
+func (t *Tree[V]) Search(key []byte) V {
+	v, _ := t.Get(key)
+	return v
+}
+
+// 查找 key，ok 标识 key 是否存在
+// 不加锁、不重试，也不等待写者，每个节点只读取固定次数的原子变量
+func (t *Tree[V]) Get(key []byte) (v V, ok bool) {
+	n := t.root
+	for {
+		// 乐观比较前缀，跳过的部分由叶子节点校验
+		in := n.asInner()
+		if !in.checkPrefix(key) {
+			return v, false
+		}
+
+		var next *node[V]
+		if level := int(in.level); level == len(key) {
+			next = in.leaf.Load()
+		} else {
+			next = n.findChild(key[level])
+		}
+		if next == nil {
+			return v, false
+		}
+		if next.isLeaf() {
+			if l := next.asLeaf(); bytes.Equal(l.key, key) {
+				return l.val, true
+			}
+			return v, false
+		}
+		n = next
+	}
+}
+
+// 删除 key，ok 标识 key 是否存在，old 为被删除的值
+func (t *Tree[V]) Delete(key []byte) (old V, ok bool) {
+	for {
+		if old, ok, retry := t.tryDelete(key); !retry {
+			return old, ok
+		}
+	}
+}
+
+func (t *Tree[V]) tryDelete(key []byte) (old V, ok, retry bool) {
+	var (
+		parent        *node[V]
+		parentVersion uint64
+		parentKey     byte
+	)
+	n := t.root
+	v, _ := n.readLock()
+	for {
+		in := n.asInner()
+		if !in.checkPrefix(key) {
+			return old, false, !n.check(v)
+		}
+
+		level := int(in.level)
+		atLeaf := level == len(key)
+		var next *node[V]
+		if atLeaf {
+			next = in.leaf.Load()
+		} else {
+			next = n.findChild(key[level])
+		}
+		if !n.check(v) {
+			return old, false, true
+		}
+		if next == nil {
+			return old, false, false
+		}
+
+		if next.isLeaf() {
+			l := next.asLeaf()
+			if !bytes.Equal(l.key, key) {
+				return old, false, false
+			}
+			var k byte
+			if !atLeaf {
+				k = key[level]
+			}
+			if !t.remove(parent, parentVersion, parentKey, n, v, atLeaf, k) {
+				return old, false, true
+			}
+			t.size.Add(-1)
+			return l.val, true, false
+		}
+
+		nv, valid := next.readLock()
+		if !valid || !n.check(v) {
+			return old, false, true
+		}
+		parent, parentVersion, parentKey = n, v, key[level]
+		n, v = next, nv
+	}
+}
+
+// 从 n 中摘除叶子节点，atLeaf 为 true 时摘除 n 的 leaf，否则摘除 key 为 k 的子节点
+// 剩余子节点足够时只锁 n 原地删除；否则连同父节点一起加锁，用收缩后的新节点替换 n
+// NODE4 只剩一个 leaf 或子节点时被其替换，剩下的是内部节点则还需锁住它，把 n 的前缀合并进去
+// 返回 false 表示加锁失败，已释放所有锁，需从头重试
+func (t *Tree[V]) remove(parent *node[V], parentVersion uint64, parentKey byte, n *node[V], v uint64, atLeaf bool, k byte) bool {
+	in := n.asInner()
+	size := int(in.size.Load())
+	hasLeaf := in.leaf.Load() != nil
+	if atLeaf {
+		hasLeaf = false
+	} else {
+		size--
+	}
+	remains := size
+	if hasLeaf {
+		remains++
+	}
+
+	// root 没有父节点，不会收缩
+	if parent == nil || (n.nodeType == NODE4 && remains >= MIN_NODE4) || (n.nodeType != NODE4 && size >= n.minSize()) {
+		if !n.upgrade(v) {
+			return false
+		}
+		if parent != nil && !parent.check(parentVersion) {
+			n.unlock()
+			return false
+		}
+		if atLeaf {
+			in.leaf.Store(nil)
+		} else {
+			n.removeChild(k)
+		}
+		n.unlock()
+		return true
+	}
+
+	if !parent.upgrade(parentVersion) {
+		return false
+	}
+	if !n.upgrade(v) {
+		parent.unlock()
+		return false
+	}
+	var next *node[V]
+	if n.nodeType != NODE4 {
+		next = n.shrink(k)
+	} else if next = n.collapse(atLeaf, k); next == nil {
+		n.unlock()
+		parent.unlock()
+		return false
+	}
+	parent.childRef(parentKey).Store(next)
+	n.unlockObsolete()
+	parent.unlock()
+	return true
+}
+
+func (t *Tree[V]) Size() int {
+	return int(t.size.Load())
+}
+
+func (t *Tree[V]) Dump() map[string]V {
+	m := make(map[string]V)
+	for k, v := range t.All() {
+		m[string(k)] = v
+	}
+	return m
+}
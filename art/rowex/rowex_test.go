@@ -0,0 +1,476 @@
+package rowex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"trees"
+	"trees/art"
+	"trees/art/olc"
+	"trees/conformance"
+)
+
+//
+// 功能 case
+//
+func TestBasic(t *testing.T) {
+	t1 := New[string]()
+	t1.Insert([]byte("ab"), "AB")
+	assert.Equal(t, t1.Size(), 1)
+	assert.Equal(t, t1.Search([]byte("ab")), "AB")
+
+	// 叶子分裂
+	t1.Insert([]byte("abc"), "ABC")
+	t1.Insert([]byte("abd"), "ABD")
+	child := t1.root.findChild('a')
+	assert.Equal(t, child.nodeType, NODE4)
+	assert.Equal(t, child.level(), 2)
+	prefixLen, _ := child.asInner().loadPrefix()
+	assert.Equal(t, prefixLen, 1)
+	assert.Equal(t, child.asInner().leaf.Load().asLeaf().key, []byte("ab"))
+
+	// 前缀分裂，原节点的 level 不变，只截短前缀
+	old := child
+	t1.Insert([]byte("a"), "A")
+	child = t1.root.findChild('a')
+	assert.Equal(t, child.level(), 1)
+	prefixLen, _ = child.asInner().loadPrefix()
+	assert.Equal(t, prefixLen, 0)
+	assert.Equal(t, child.asInner().leaf.Load().asLeaf().key, []byte("a"))
+	assert.Equal(t, child.findChild('b'), old)
+	assert.Equal(t, old.level(), 2)
+	prefixLen, _ = old.asInner().loadPrefix()
+	assert.Equal(t, prefixLen, 0)
+
+	// 更新替换叶子节点
+	prev, replaced := t1.Put([]byte("abc"), "abc")
+	assert.True(t, replaced)
+	assert.Equal(t, prev, "ABC")
+	existing, loaded := t1.PutIfAbsent([]byte("abc"), "-")
+	assert.True(t, loaded)
+	assert.Equal(t, existing, "abc")
+
+	// 删除后 NODE4 合并到唯一的子节点
+	t1.Delete([]byte("a"))
+	t1.Delete([]byte("abd"))
+	child = t1.root.findChild('a')
+	assert.Equal(t, child, old)
+	prefixLen, _ = child.asInner().loadPrefix()
+	assert.Equal(t, prefixLen, 1)
+	t1.Delete([]byte("ab"))
+	assert.True(t, t1.root.findChild('a').isLeaf())
+	assert.Equal(t, t1.Dump(), map[string]string{"abc": "abc"})
+}
+
+// 节点逐级扩容到 NODE256 再逐级收缩，每一步都替换为新节点，旧节点被标记为废弃
+func TestNodeReplace(t *testing.T) {
+	t1 := New[int]()
+	key := func(i int) []byte { return []byte{'k', byte(i)} }
+	var olds []*node[int]
+	for i := 0; i < 256; i++ {
+		t1.Insert(key(i), i)
+		n := t1.root.findChild('k')
+		switch i + 1 {
+		case 2, MAX_NODE4, MAX_NODE16, MAX_NODE48:
+			olds = append(olds, n)
+		case MAX_NODE4 + 1, MAX_NODE16 + 1, MAX_NODE48 + 1:
+			assert.True(t, olds[len(olds)-1].version.Load()&obsoleteBit != 0)
+		}
+	}
+	n := t1.root.findChild('k')
+	assert.Equal(t, n.nodeType, NODE256)
+	assert.Equal(t, n.asInner().size.Load(), uint32(256))
+	assert.Equal(t, n.level(), 1)
+
+	for i := 255; i >= 1; i-- {
+		t1.Delete(key(i))
+		n = t1.root.findChild('k')
+		switch {
+		case i >= MIN_NODE256:
+			assert.Equal(t, n.nodeType, NODE256)
+		case i >= MIN_NODE48:
+			assert.Equal(t, n.nodeType, NODE48)
+		case i >= MIN_NODE16:
+			assert.Equal(t, n.nodeType, NODE16)
+		case i >= MIN_NODE4:
+			assert.Equal(t, n.nodeType, NODE4)
+		default:
+			assert.True(t, n.isLeaf())
+		}
+		v, ok := t1.Get(key(0))
+		assert.True(t, ok)
+		assert.Equal(t, v, 0)
+	}
+	assert.Equal(t, t1.Size(), 1)
+}
+
+// 合并时前缀超过存储长度，存储的部分由父节点前缀、key 和子节点前缀拼接
+func TestCollapseLongPrefix(t *testing.T) {
+	t1 := New[int]()
+	long := bytes.Repeat([]byte("p"), 12)
+	keys := [][]byte{
+		append(append([]byte("a"), long...), "x1"...),
+		append(append([]byte("a"), long...), "x2"...),
+		append(append([]byte("a"), long...), 'y'),
+		[]byte("ab"),
+	}
+	for i, k := range keys {
+		t1.Insert(k, i)
+	}
+	t1.Delete(keys[2])
+	t1.Delete(keys[3])
+	n := t1.root.findChild('a')
+	prefixLen, stored := n.asInner().loadPrefix()
+	assert.Equal(t, prefixLen, len(long)+1)
+	assert.Equal(t, stored, [MAX_PREFIX_LEN]byte([]byte("pppp")))
+	for i, k := range keys[:2] {
+		v, ok := t1.Get(k)
+		assert.True(t, ok)
+		assert.Equal(t, v, i)
+	}
+	k, _ := t1.Ceiling(append(append([]byte("a"), long...), 'x'))
+	assert.Equal(t, k, keys[0])
+}
+
+// NODE4 的槽位只追加不复用，删除后再添加同一个 key 会用掉新的槽位，槽位用尽时压缩为新的 NODE4
+func TestAppendOnlySlots(t *testing.T) {
+	t1 := New[int]()
+	for _, k := range []string{"ka", "kb", "kc"} {
+		t1.Insert([]byte(k), int(k[1]))
+	}
+	n := t1.root.findChild('k')
+	t1.Delete([]byte("kb"))
+	t1.Insert([]byte("kb"), 0)
+	assert.Equal(t, t1.root.findChild('k'), n)
+	assert.Equal(t, n.asInner().used.Load(), uint32(4))
+	assert.Equal(t, n.asInner().size.Load(), uint32(3))
+	k, _ := n.childGE('b')
+	assert.Equal(t, k, int('b'))
+	k, _ = n.childLE('b' - 1)
+	assert.Equal(t, k, int('a'))
+
+	t1.Delete([]byte("kc"))
+	t1.Insert([]byte("kd"), 0)
+	compacted := t1.root.findChild('k')
+	assert.NotEqual(t, compacted, n)
+	assert.True(t, n.version.Load()&obsoleteBit != 0)
+	assert.Equal(t, compacted.nodeType, NODE4)
+	assert.Equal(t, compacted.asInner().used.Load(), uint32(3))
+	assert.Equal(t, t1.Dump(), map[string]int{"ka": 'a', "kb": 0, "kd": 0})
+}
+
+// 写者持有锁时读者不等待：Get 和遍历都不读取版本锁
+func TestReaderNeverBlocks(t *testing.T) {
+	t1 := New[int]()
+	for i := 0; i < 100; i++ {
+		t1.Insert([]byte(fmt.Sprintf("k%02d", i)), i)
+	}
+	n := t1.root.findChild('k')
+	assert.True(t, t1.root.writeLock())
+	assert.True(t, n.writeLock())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v, ok := t1.Get([]byte("k42"))
+		assert.True(t, ok)
+		assert.Equal(t, v, 42)
+		assert.Equal(t, t1.CountPrefix([]byte("k")), 100)
+	}()
+	<-done
+	n.unlock()
+	t1.root.unlock()
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func() trees.IndexTree { return NewArtTree() })
+}
+
+func FuzzConformance(f *testing.F) {
+	conformance.Fuzz(f, func() trees.IndexTree { return NewArtTree() })
+}
+
+//
+// 并发 case，需配合 go test -race
+//
+// 多个写者交错地写入同一批节点，各自只负责 key 编号模 writers 余 w 的 key，结束后逐个校验
+// 预先写入的 stable key 不会被修改：读者期间必须总能查到，扫描时必须总能完整、有序地遍历到
+func TestConcurrent(t *testing.T) {
+	const (
+		writers  = 4
+		readers  = 2
+		scanners = 2
+		n        = 2000
+		stable   = 200
+		ops      = 20000
+	)
+	if testing.Short() {
+		t.Skip()
+	}
+	tree := New[int]()
+	key := func(i int) []byte {
+		// 共享前缀使各个写者竞争同一批节点，长短不一的后缀覆盖叶子分裂、前缀分裂和节点合并
+		k := binary.BigEndian.AppendUint16([]byte("user/"), uint16(i))
+		return append(k, bytes.Repeat([]byte{'x'}, i%11)...)
+	}
+	stableKey := func(i int) []byte { return []byte(fmt.Sprintf("user/stable/%04d", i)) }
+	for i := 0; i < stable; i++ {
+		tree.Insert(stableKey(i), -i)
+	}
+
+	models := make([]map[int]int, writers)
+	var wg sync.WaitGroup
+	var done sync.WaitGroup
+	stop := make(chan struct{})
+	for w := 0; w < writers; w++ {
+		models[w] = make(map[int]int)
+		wg.Add(1)
+		go func(w int, model map[int]int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			for op := 0; op < ops; op++ {
+				i := r.Intn(n/writers)*writers + w
+				k := key(i)
+				switch r.Intn(4) {
+				case 0, 1:
+					old, replaced := tree.Put(k, op)
+					want, ok := model[i]
+					assert.Equal(t, replaced, ok)
+					assert.Equal(t, old, want)
+					model[i] = op
+				case 2:
+					old, ok := tree.Delete(k)
+					want, exists := model[i]
+					assert.Equal(t, ok, exists)
+					assert.Equal(t, old, want)
+					delete(model, i)
+				case 3:
+					v, ok := tree.Get(k)
+					want, exists := model[i]
+					assert.Equal(t, ok, exists)
+					assert.Equal(t, v, want)
+				}
+			}
+		}(w, models[w])
+	}
+
+	for g := 0; g < readers; g++ {
+		done.Add(1)
+		go func(g int) {
+			defer done.Done()
+			r := rand.New(rand.NewSource(int64(100 + g)))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				i := r.Intn(stable)
+				v, ok := tree.Get(stableKey(i))
+				assert.True(t, ok)
+				assert.Equal(t, v, -i)
+				runtime.Gosched()
+			}
+		}(g)
+	}
+
+	for g := 0; g < scanners; g++ {
+		done.Add(1)
+		go func(g int) {
+			defer done.Done()
+			for round := 0; ; round++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				var prev []byte
+				cnt := 0
+				scan := tree.All()
+				if round%2 == 1 {
+					scan = tree.Backward()
+				}
+				for k := range scan {
+					if prev != nil {
+						c := bytes.Compare(prev, k)
+						assert.True(t, c < 0 == (round%2 == 0) && c != 0, "scan out of order: %q %q", prev, k)
+					}
+					if bytes.HasPrefix(k, []byte("user/stable/")) {
+						cnt++
+					}
+					prev = k
+				}
+				assert.Equal(t, cnt, stable)
+				assert.Equal(t, tree.CountPrefix([]byte("user/stable/")), stable)
+			}
+		}(g)
+	}
+
+	wg.Wait()
+	close(stop)
+	done.Wait()
+
+	want := make(map[string]int)
+	for i := 0; i < stable; i++ {
+		want[string(stableKey(i))] = -i
+	}
+	for _, model := range models {
+		for i, v := range model {
+			want[string(key(i))] = v
+		}
+	}
+	assert.Equal(t, tree.Dump(), want)
+	assert.Equal(t, tree.Size(), len(want))
+}
+
+// 并发 PopMin 每个 key 恰好被弹出一次
+func TestConcurrentPop(t *testing.T) {
+	const n, workers = 4000, 4
+	tree := New[int]()
+	for i := 0; i < n; i++ {
+		tree.Insert(binary.BigEndian.AppendUint32(nil, uint32(i)), i)
+	}
+	popped := make([][]int, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for {
+				pop := tree.PopMin
+				if w%2 == 1 {
+					pop = tree.PopMax
+				}
+				k, v := pop()
+				if k == nil {
+					return
+				}
+				assert.Equal(t, int(binary.BigEndian.Uint32(k)), v)
+				popped[w] = append(popped[w], v)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make([]bool, n)
+	for _, vs := range popped {
+		for _, v := range vs {
+			assert.False(t, seen[v])
+			seen[v] = true
+		}
+	}
+	for i := range seen {
+		assert.True(t, seen[i])
+	}
+	assert.Equal(t, tree.Size(), 0)
+}
+
+//
+// 性能 case
+//
+// 并发读写对比 ROWEX、OLC 与加读写锁的 art.Tree：go test -run XXX -bench Concurrent -cpu 1,4,8 ./art/rowex/
+// 除吞吐外，每 16 次读取采样一次耗时，报告读取的 p99 延迟
+type concurrentTree interface {
+	Get(key []byte) (int, bool)
+	Put(key []byte, val int) (int, bool)
+	Delete(key []byte) (int, bool)
+}
+
+type lockedTree struct {
+	mu sync.RWMutex
+	t  *art.Tree[int]
+}
+
+func (l *lockedTree) Get(key []byte) (int, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.t.Get(key)
+}
+
+func (l *lockedTree) Put(key []byte, val int) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.t.Put(key, val)
+}
+
+func (l *lockedTree) Delete(key []byte) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.t.Delete(key)
+}
+
+func BenchmarkConcurrent(b *testing.B) {
+	const n = 1 << 16
+	r := rand.New(rand.NewSource(1))
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = binary.BigEndian.AppendUint64(nil, r.Uint64())
+	}
+	impls := []struct {
+		name string
+		new  func() concurrentTree
+	}{
+		{"rowex", func() concurrentTree { return New[int]() }},
+		{"olc", func() concurrentTree { return olc.New[int]() }},
+		{"mutex", func() concurrentTree { return &lockedTree{t: art.New[int]()} }},
+	}
+	workloads := []struct {
+		name     string
+		writePct int
+	}{
+		{"read", 0},
+		{"read90", 10},
+		{"write50", 50},
+	}
+
+	for _, w := range workloads {
+		for _, impl := range impls {
+			b.Run(w.name+"/"+impl.name, func(b *testing.B) {
+				tree := impl.new()
+				for i, k := range keys {
+					tree.Put(k, i)
+				}
+				var (
+					seed    atomic.Int64
+					mu      sync.Mutex
+					samples []time.Duration
+				)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					r := rand.New(rand.NewSource(seed.Add(1)))
+					var local []time.Duration
+					for op := 0; pb.Next(); op++ {
+						i := r.Intn(n)
+						switch p := r.Intn(100); {
+						case p < w.writePct/2:
+							tree.Put(keys[i], i)
+						case p < w.writePct:
+							tree.Delete(keys[i])
+						case op%16 == 0:
+							start := time.Now()
+							tree.Get(keys[i])
+							local = append(local, time.Since(start))
+						default:
+							tree.Get(keys[i])
+						}
+					}
+					mu.Lock()
+					samples = append(samples, local...)
+					mu.Unlock()
+				})
+				b.StopTimer()
+				if len(samples) > 0 {
+					sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+					b.ReportMetric(float64(samples[len(samples)*99/100].Nanoseconds()), "p99-ns/get")
+				}
+			})
+		}
+	}
+}
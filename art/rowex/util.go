@@ -0,0 +1,7 @@
+package rowex
+
+func cp(src []byte) []byte {
+	dst := make([]byte, len(src))
+	copy(dst, src)
+	return dst
+}
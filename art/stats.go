@@ -0,0 +1,55 @@
+package art
+
+import (
+	"trees"
+	"unsafe"
+)
+
+// 遍历整棵树统计结构，节点按类型计数，深度为从 root 到叶子经过的内部节点数
+func (t *Tree[V]) Stats() trees.Stats {
+	s := trees.Stats{Keys: t.size, Nodes: make(map[string]int)}
+	if t.root != nil {
+		t.stats(&s, t.root, 0)
+	}
+	if s.Keys > 0 {
+		s.BytesPerKey = float64(s.Bytes) / float64(s.Keys)
+	}
+	return s
+}
+
+func (t *Tree[V]) stats(s *trees.Stats, n *node[V], depth int) {
+	s.Nodes[n.nodeType.String()]++
+	s.Bytes += n.sizeof()
+	if n.isLeaf() {
+		s.Depth = trees.Observe(s.Depth, depth)
+		return
+	}
+
+	in := n.asInner()
+	s.Fanout = trees.Observe(s.Fanout, int(in.size))
+	s.PrefixLen = trees.Observe(s.PrefixLen, int(in.prefixLen))
+	if int(in.prefixLen) > t.opts.prefixLen {
+		s.OptimisticPrefixes++
+	}
+	if in.leaf != nil {
+		t.stats(s, in.leaf, depth+1)
+	}
+	for k, child := n.childGE(0); child != nil; k, child = n.childGE(k + 1) {
+		t.stats(s, child, depth+1)
+	}
+}
+
+// 节点占用的字节数，叶子包含 key 的底层数组，零拷贝时 key 的内存实际属于调用方
+func (n *node[V]) sizeof() int {
+	switch n.nodeType {
+	case NODE4:
+		return int(unsafe.Sizeof(node4[V]{}))
+	case NODE16:
+		return int(unsafe.Sizeof(node16[V]{}))
+	case NODE48:
+		return int(unsafe.Sizeof(node48[V]{}))
+	case NODE256:
+		return int(unsafe.Sizeof(node256[V]{}))
+	}
+	return int(unsafe.Sizeof(leaf[V]{})) + cap(n.asLeaf().key)
+}
@@ -0,0 +1,150 @@
+package art
+
+import (
+	"bytes"
+	"trees"
+	"trees/utils"
+)
+
+// 校验树的结构不变量，返回第一处错误及从 root 到出错节点依次经过的子节点 key，用于测试和调试
+// 包括：size 与叶子数一致，子节点与 size 一致且 NODE4/16 的 key 有序、NODE48 的索引一一对应，
+// 节点不低于收缩下限，压缩前缀与其下所有叶子的 key 一致
+func (t *Tree[V]) Validate() error {
+	cnt := 0
+	if t.root != nil {
+		if _, err := t.validate(t.root, nil, 0, &cnt); err != nil {
+			return err
+		}
+	}
+	if cnt != t.size {
+		return trees.Invalid(nil, "size %d, found %d leaves", t.size, cnt)
+	}
+	return nil
+}
+
+// 后序校验 n 的子树，返回其中最小的 key，n 的前缀从 depth 开始
+// 每个节点校验各子树的最小 key 与自身的最小 key 共享到前缀结束为止的所有字节，子树内部由子节点自行校验
+func (t *Tree[V]) validate(n *node[V], path []byte, depth int, cnt *int) (min []byte, err error) {
+	if n.nodeType == LEAF {
+		*cnt++
+		if key := n.asLeaf().key; len(key) < depth {
+			return nil, trees.Invalid(path, "leaf %q is shorter than depth %d", key, depth)
+		}
+		return n.asLeaf().key, nil
+	}
+
+	// 1. 子节点与 size
+	keys, childs, err := t.children(n, path)
+	if err != nil {
+		return nil, err
+	}
+	in := n.asInner()
+	if n.nodeType == NODE4 {
+		if remains := len(childs) + btoi(in.leaf != nil); remains < MIN_NODE4 {
+			return nil, trees.Invalid(path, "NODE4 has %d entries, below %d", remains, MIN_NODE4)
+		}
+	} else if lower := n.minSize() - t.opts.shrinkHysteresis; len(childs) < lower {
+		return nil, trees.Invalid(path, "%s has %d children, below %d", n.nodeType, len(childs), lower)
+	}
+
+	// 2. 前缀结束处的 leaf
+	end := depth + int(in.prefixLen)
+	if in.leaf != nil {
+		if in.leaf.nodeType != LEAF {
+			return nil, trees.Invalid(path, "leaf slot holds %s", in.leaf.nodeType)
+		}
+		*cnt++
+		if min = in.leaf.asLeaf().key; len(min) != end {
+			return nil, trees.Invalid(path, "leaf %q does not end at prefix end %d", min, end)
+		}
+	}
+
+	// 3. 各子树的 key 在 end 处为其在 n 中的 key，之前的字节与最小 key 相同
+	for i, child := range childs {
+		m, err := t.validate(child, append(path[:len(path):len(path)], keys[i]), end+1, cnt)
+		if err != nil {
+			return nil, err
+		}
+		if len(m) <= end || m[end] != keys[i] {
+			return nil, trees.Invalid(path, "child %q at key %#x", m, keys[i])
+		}
+		if min == nil {
+			min = m
+		} else if !bytes.Equal(m[:end], min[:end]) {
+			return nil, trees.Invalid(path, "child %q disagrees with prefix %q", m, min[:end])
+		}
+	}
+
+	// 4. 存储的前缀
+	stored := utils.Min(int(in.prefixLen), t.opts.prefixLen)
+	if !bytes.Equal(in.prefix[:stored], min[depth:depth+stored]) {
+		return nil, trees.Invalid(path, "stored prefix %q, keys have %q", in.prefix[:stored], min[depth:depth+stored])
+	}
+	return min, nil
+}
+
+// 校验节点的槽位并按升序返回子节点
+func (t *Tree[V]) children(n *node[V], path []byte) (keys []byte, childs []*node[V], err error) {
+	size := int(n.asInner().size)
+	switch n.nodeType {
+	case NODE4, NODE16:
+		ks, cs := n.sortedChilds()
+		if size > len(cs) {
+			return nil, nil, trees.Invalid(path, "%s size %d exceeds capacity", n.nodeType, size)
+		}
+		for i, c := range cs {
+			switch {
+			case i < size && c == nil:
+				return nil, nil, trees.Invalid(path, "%s child %d is nil", n.nodeType, i)
+			case i >= size && c != nil:
+				return nil, nil, trees.Invalid(path, "%s child %d beyond size %d", n.nodeType, i, size)
+			case i > 0 && i < size && ks[i] <= ks[i-1]:
+				return nil, nil, trees.Invalid(path, "%s keys not sorted: %x", n.nodeType, ks[:size])
+			}
+		}
+		return ks[:size], cs[:size], nil
+	case NODE48:
+		n48 := n.asNode48()
+		var used [MAX_NODE48]bool
+		for k, idx := range n48.keys {
+			switch {
+			case idx == 0:
+				continue
+			case idx > MAX_NODE48:
+				return nil, nil, trees.Invalid(path, "NODE48 key %#x points to slot %d", k, idx)
+			case used[idx-1]:
+				return nil, nil, trees.Invalid(path, "NODE48 slot %d is shared", idx-1)
+			case n48.childs[idx-1] == nil:
+				return nil, nil, trees.Invalid(path, "NODE48 key %#x points to empty slot %d", k, idx-1)
+			}
+			used[idx-1] = true
+			keys = append(keys, byte(k))
+			childs = append(childs, n48.childs[idx-1])
+		}
+		for i, c := range n48.childs {
+			if !used[i] && c != nil {
+				return nil, nil, trees.Invalid(path, "NODE48 slot %d is not referenced", i)
+			}
+		}
+	case NODE256:
+		for k, c := range n.asNode256().childs {
+			if c != nil {
+				keys = append(keys, byte(k))
+				childs = append(childs, c)
+			}
+		}
+	default:
+		return nil, nil, trees.Invalid(path, "unknown node type %d", n.nodeType)
+	}
+	if len(childs) != size {
+		return nil, nil, trees.Invalid(path, "%s size %d, found %d children", n.nodeType, size, len(childs))
+	}
+	return keys, childs, nil
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,453 @@
+// 索引树的一致性测试套件
+// 将任意 IndexTree 实现与有序 map 参考模型执行同一组操作序列并逐步比对，失败时收缩出最短的复现序列
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"trees"
+)
+
+type OpKind uint8
+
+const (
+	OpPut OpKind = iota
+	OpPutIfAbsent
+	OpDelete
+	OpGet
+	OpPopMin
+	OpPopMax
+	opKinds
+)
+
+func (k OpKind) String() string {
+	switch k {
+	case OpPut:
+		return "Put"
+	case OpPutIfAbsent:
+		return "PutIfAbsent"
+	case OpDelete:
+		return "Delete"
+	case OpGet:
+		return "Get"
+	case OpPopMin:
+		return "PopMin"
+	case OpPopMax:
+		return "PopMax"
+	}
+	return fmt.Sprintf("OpKind(%d)", k)
+}
+
+type Op struct {
+	Kind OpKind
+	Key  []byte
+	Val  int
+}
+
+func (op Op) String() string {
+	switch op.Kind {
+	case OpPut, OpPutIfAbsent:
+		return fmt.Sprintf("%s(%q, %d)", op.Kind, op.Key, op.Val)
+	case OpPopMin, OpPopMax:
+		return fmt.Sprintf("%s()", op.Kind)
+	}
+	return fmt.Sprintf("%s(%q)", op.Kind, op.Key)
+}
+
+// 构造空树
+type Factory func() trees.IndexTree
+
+// 实现尚未修复的已知问题，Affects 按参考模型的当前内容判断 op 是否会触发该问题
+// Replay 跳过受影响的 op，其余 op 照常比对；修复后移除对应的条目，套件即覆盖到修复的路径
+type KnownIssue struct {
+	Name    string
+	Affects func(model map[string]int, op Op) bool
+}
+
+func affected(known []KnownIssue, model map[string]int, op Op) bool {
+	for _, issue := range known {
+		if issue.Affects(model, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// 容易触发边界 case 的 key：空 key、NULL 字节、互为前缀、长公共前缀、0xff
+func NastyKeys() [][]byte {
+	long := bytes.Repeat([]byte("p"), 100)
+	keys := [][]byte{
+		{}, {0x00}, {0x00, 0x00}, {0x00, 0x01}, {0x01}, {0xff}, {0xff, 0xff}, {0xff, 0x00},
+		[]byte("a"), []byte("ab"), []byte("abc"), []byte("abd"), []byte("b"),
+		[]byte("a\x00"), []byte("a\x00b"), []byte("a\x00\x00"), []byte("ab\x00c"),
+		[]byte("12345678"), []byte("123456789"), []byte("12345678abcd"), []byte("12345678abef"), []byte("12345678xy"),
+		long, append(cp(long), 'a'), append(cp(long), 'b'), append(cp(long), 0x00), long[:50], long[:9],
+		append(append(cp(long[:20]), 0x00), long[:20]...),
+	}
+	return keys
+}
+
+// 对 factory 构造的树执行固定与随机的操作序列
+func Run(t *testing.T, factory Factory, known ...KnownIssue) {
+	t.Run("nasty", func(t *testing.T) {
+		keys := NastyKeys()
+		var ops []Op
+		for i, k := range keys {
+			ops = append(ops, Op{Kind: OpPut, Key: k, Val: i})
+		}
+		for i, k := range keys {
+			ops = append(ops, Op{Kind: OpPutIfAbsent, Key: k, Val: -i}, Op{Kind: OpGet, Key: k})
+		}
+		for i := len(keys) - 1; i >= 0; i-- {
+			ops = append(ops, Op{Kind: OpDelete, Key: keys[i]}, Op{Kind: OpDelete, Key: keys[i]})
+		}
+		Check(t, factory, ops, known...)
+	})
+
+	// 单字节与双字节 key 撑满各类 node，再逐个删除触发收缩
+	t.Run("dense", func(t *testing.T) {
+		var ops []Op
+		for i := 0; i < 256; i++ {
+			ops = append(ops, Op{Kind: OpPut, Key: []byte{byte(i)}, Val: i})
+			ops = append(ops, Op{Kind: OpPut, Key: []byte{'k', byte(i)}, Val: i})
+		}
+		r := rand.New(rand.NewSource(1))
+		for _, i := range r.Perm(256) {
+			ops = append(ops, Op{Kind: OpDelete, Key: []byte{byte(i)}})
+			ops = append(ops, Op{Kind: OpDelete, Key: []byte{'k', byte(i)}})
+		}
+		Check(t, factory, ops, known...)
+	})
+
+	t.Run("random", func(t *testing.T) {
+		seed := time.Now().UnixNano()
+		r := rand.New(rand.NewSource(seed))
+		rounds := 200
+		if testing.Short() {
+			rounds = 20
+		}
+		for i := 0; i < rounds; i++ {
+			if !Check(t, factory, RandOps(r, 500), known...) {
+				t.Logf("seed: %d, round: %d", seed, i)
+				return
+			}
+		}
+	})
+}
+
+// 以 NastyKeys 为种子语料运行模糊测试
+func Fuzz(f *testing.F, factory Factory, known ...KnownIssue) {
+	keys := NastyKeys()
+	var ops []Op
+	for i, k := range keys {
+		ops = append(ops, Op{Kind: OpPut, Key: k, Val: i})
+		f.Add(Encode(ops))
+	}
+	for _, k := range keys {
+		ops = append(ops, Op{Kind: OpDelete, Key: k})
+	}
+	f.Add(Encode(ops))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Check(t, factory, Decode(data), known...)
+	})
+}
+
+// 生成 n 个随机操作，key 由少量字符组成以产生大量公共前缀，并有一半概率复用已生成的 key
+func RandOps(r *rand.Rand, n int) []Op {
+	alphabet := []byte{0x00, 0x01, 'a', 'b', 'c', 0xfe, 0xff}
+	nasty := NastyKeys()
+	var used [][]byte
+	ops := make([]Op, n)
+	for i := range ops {
+		var key []byte
+		switch x := r.Intn(10); {
+		case x < 5 && len(used) > 0:
+			key = used[r.Intn(len(used))]
+		case x < 6:
+			key = nasty[r.Intn(len(nasty))]
+		default:
+			key = make([]byte, r.Intn(12))
+			for j := range key {
+				key[j] = alphabet[r.Intn(len(alphabet))]
+			}
+			used = append(used, key)
+		}
+		kind := OpKind(r.Intn(int(opKinds)))
+		if (kind == OpPopMin || kind == OpPopMax) && r.Intn(4) > 0 {
+			kind = OpGet // 降低 Pop 的比例，避免树始终很小
+		}
+		ops[i] = Op{Kind: kind, Key: key, Val: i}
+	}
+	return ops
+}
+
+// 编码格式：每个操作依次为 kind、key 长度、key 字节，Val 取操作序号
+func Encode(ops []Op) []byte {
+	var buf []byte
+	for _, op := range ops {
+		buf = append(buf, byte(op.Kind), byte(len(op.Key)))
+		buf = append(buf, op.Key...)
+	}
+	return buf
+}
+
+func Decode(data []byte) []Op {
+	var ops []Op
+	for len(data) >= 2 {
+		kind, n := OpKind(data[0]%byte(opKinds)), int(data[1])
+		data = data[2:]
+		if n > len(data) {
+			n = len(data)
+		}
+		ops = append(ops, Op{Kind: kind, Key: cp(data[:n]), Val: len(ops)})
+		data = data[n:]
+	}
+	return ops
+}
+
+// 执行 ops 并与参考模型比对，失败时收缩出最短的复现序列并报告
+func Check(t *testing.T, factory Factory, ops []Op, known ...KnownIssue) bool {
+	t.Helper()
+	err := Replay(factory, ops, known...)
+	if err == nil {
+		return true
+	}
+	min := Shrink(factory, ops, known...)
+	var sb strings.Builder
+	for i, op := range min {
+		fmt.Fprintf(&sb, "\n\t%d: %s", i, op)
+	}
+	t.Errorf("%v\nminimal failing sequence (%d of %d ops):%s\nerror: %v", err, len(min), len(ops), sb.String(), Replay(factory, min, known...))
+	return false
+}
+
+// 反复删除仍能复现失败的操作块，直到无法再删除
+func Shrink(factory Factory, ops []Op, known ...KnownIssue) []Op {
+	for chunk := len(ops) / 2; chunk >= 1; chunk /= 2 {
+		for i := 0; i+chunk <= len(ops); {
+			candidate := append(append([]Op{}, ops[:i]...), ops[i+chunk:]...)
+			if Replay(factory, candidate, known...) != nil {
+				ops = candidate
+				continue
+			}
+			i += chunk
+		}
+	}
+	return ops
+}
+
+// 在新建的树上重放 ops，返回第一个与参考模型不一致之处，panic 也视为失败
+// 受已知问题影响的 op 既不作用于树也不作用于模型
+func Replay(factory Factory, ops []Op, known ...KnownIssue) (err error) {
+	tree := factory()
+	model := make(map[string]int)
+	i := 0
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("after %d ops: panic: %v", i, r)
+		}
+	}()
+
+	for ; i < len(ops); i++ {
+		op := ops[i]
+		if affected(known, model, op) {
+			continue
+		}
+		if op.Kind == OpPopMin || op.Kind == OpPopMax {
+			if err := checkPop(tree, model, op); err != nil {
+				return fmt.Errorf("op %d %s: %v", i, op, err)
+			}
+			if err := validate(tree); err != nil {
+				return fmt.Errorf("op %d %s: %v", i, op, err)
+			}
+			continue
+		}
+		want, exist := model[string(op.Key)]
+		var got interface{}
+		var ok bool
+
+		// 每次传入新拷贝的 key，操作后再覆写，以暴露树内部对调用方 key 的引用
+		key := cp(op.Key)
+		switch op.Kind {
+		case OpPut:
+			got, ok = tree.Put(key, op.Val)
+			model[string(op.Key)] = op.Val
+		case OpPutIfAbsent:
+			got, ok = tree.PutIfAbsent(key, op.Val)
+			if !exist {
+				model[string(op.Key)] = op.Val
+			}
+		case OpDelete:
+			got, ok = tree.Delete(key)
+			delete(model, string(op.Key))
+		case OpGet:
+			got, ok = tree.Get(key)
+		}
+		for j := range key {
+			key[j] = 0xaa
+		}
+		if ok != exist || (exist && got != want) {
+			return fmt.Errorf("op %d %s: got (%v, %t), want (%v, %t)", i, op, got, ok, want, exist)
+		}
+		if tree.Size() != len(model) {
+			return fmt.Errorf("op %d %s: size %d, want %d", i, op, tree.Size(), len(model))
+		}
+		if err := validate(tree); err != nil {
+			return fmt.Errorf("op %d %s: %v", i, op, err)
+		}
+		if op.Kind == OpGet {
+			if err := checkOrdered(tree, model, op.Key); err != nil {
+				return fmt.Errorf("op %d %s: %v", i, op, err)
+			}
+		}
+	}
+	return verify(tree, model)
+}
+
+// 实现了 Validate 的树在每次操作后校验结构不变量
+func validate(tree trees.IndexTree) error {
+	if v, ok := tree.(interface{ Validate() error }); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// 全量比对：逐个查找、正反向遍历、Dump
+func verify(tree trees.IndexTree, model map[string]int) error {
+	keys := sortedKeys(model)
+	for _, k := range keys {
+		if v, ok := tree.Get([]byte(k)); !ok || v != model[k] {
+			return fmt.Errorf("final get %q: got (%v, %t), want (%d, true)", k, v, ok, model[k])
+		}
+	}
+
+	i := 0
+	for k, v := range tree.All() {
+		if i >= len(keys) {
+			return fmt.Errorf("ascending iteration: unexpected key %q", k)
+		}
+		if string(k) != keys[i] || v != model[keys[i]] {
+			return fmt.Errorf("ascending iteration at %d: got (%q, %v), want (%q, %d)", i, k, v, keys[i], model[keys[i]])
+		}
+		i++
+	}
+	if i != len(keys) {
+		return fmt.Errorf("ascending iteration: got %d keys, want %d", i, len(keys))
+	}
+	i = len(keys) - 1
+	for k := range tree.Backward() {
+		if i < 0 {
+			return fmt.Errorf("descending iteration: unexpected key %q", k)
+		}
+		if string(k) != keys[i] {
+			return fmt.Errorf("descending iteration at %d: got %q, want %q", i, k, keys[i])
+		}
+		i--
+	}
+	if i != -1 {
+		return fmt.Errorf("descending iteration: missing %d keys", i+1)
+	}
+
+	dump := tree.Dump()
+	if len(dump) != len(model) {
+		return fmt.Errorf("dump: got %d keys, want %d", len(dump), len(model))
+	}
+	for k, v := range model {
+		if got, ok := dump[k]; !ok || got != v {
+			return fmt.Errorf("dump %q: got (%v, %t), want %d", k, got, ok, v)
+		}
+	}
+	return nil
+}
+
+func sortedKeys(model map[string]int) []string {
+	keys := make([]string, 0, len(model))
+	for k := range model {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 比对 PopMin / PopMax 弹出的 key 与参考模型的最值，并同步删除模型中的 key
+func checkPop(tree trees.IndexTree, model map[string]int, op Op) error {
+	var k []byte
+	var v interface{}
+	if op.Kind == OpPopMin {
+		k, v = tree.PopMin()
+	} else {
+		k, v = tree.PopMax()
+	}
+	keys := sortedKeys(model)
+	if len(keys) == 0 {
+		if k != nil {
+			return fmt.Errorf("got (%q, %v) from empty tree", k, v)
+		}
+		return nil
+	}
+	want := keys[0]
+	if op.Kind == OpPopMax {
+		want = keys[len(keys)-1]
+	}
+	if k == nil || string(k) != want || v != model[want] {
+		return fmt.Errorf("got (%q, %v), want (%q, %d)", k, v, want, model[want])
+	}
+	delete(model, want)
+	if tree.Size() != len(model) {
+		return fmt.Errorf("size %d, want %d", tree.Size(), len(model))
+	}
+	return nil
+}
+
+// 以 key 为界比对 Min、Max、Floor、Ceiling、Lower、Higher
+func checkOrdered(tree trees.IndexTree, model map[string]int, key []byte) error {
+	keys := sortedKeys(model)
+	i := sort.SearchStrings(keys, string(key)) // 第一个 >= key
+	exact := i < len(keys) && keys[i] == string(key)
+	at := func(i int) (string, bool) {
+		if i < 0 || i >= len(keys) {
+			return "", false
+		}
+		return keys[i], true
+	}
+	floor := i - 1
+	if exact {
+		floor = i
+	}
+	higher := i
+	if exact {
+		higher = i + 1
+	}
+
+	cases := []struct {
+		name string
+		fn   func() ([]byte, interface{})
+		idx  int
+	}{
+		{"Min", tree.Min, 0},
+		{"Max", tree.Max, len(keys) - 1},
+		{"Floor", func() ([]byte, interface{}) { return tree.Floor(key) }, floor},
+		{"Ceiling", func() ([]byte, interface{}) { return tree.Ceiling(key) }, i},
+		{"Lower", func() ([]byte, interface{}) { return tree.Lower(key) }, i - 1},
+		{"Higher", func() ([]byte, interface{}) { return tree.Higher(key) }, higher},
+	}
+	for _, c := range cases {
+		k, v := c.fn()
+		want, exist := at(c.idx)
+		if (k != nil) != exist || (exist && (string(k) != want || v != model[want])) {
+			return fmt.Errorf("%s: got (%q, %v), want (%q, %t)", c.name, k, v, want, exist)
+		}
+	}
+	return nil
+}
+
+func cp(src []byte) []byte {
+	dst := make([]byte, len(src))
+	copy(dst, src)
+	return dst
+}
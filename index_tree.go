@@ -1,9 +1,64 @@
 package trees
 
-type IndexTree interface {
-	Insert(key []byte, val interface{})
-	Search(key []byte) interface{}
-	Delete([]byte) bool
+import "iter"
+
+// 所有树共同遵循的读写语义，K 为 key 的类型：
+// Get 通过 ok 区分 key 不存在和存储的零值
+// Put 总是覆盖，PutIfAbsent 从不覆盖，二者都返回 key 已存在时的旧值
+// Delete 返回被删除的值
+// Put / PutIfAbsent 返回后 Get 必然命中；限制 key 取值范围的实现对非法 key panic，Get / Delete 视其为不存在
+type Map[K, V any] interface {
+	Get(key K) (val V, ok bool)
+	Put(key K, val V) (old V, replaced bool)
+	PutIfAbsent(key K, val V) (existing V, loaded bool)
+	Delete(key K) (old V, ok bool)
+}
+
+// 值类型为 V 的索引树
+type Tree[V any] interface {
+	Map[[]byte, V]
+
+	Insert(key []byte, val V) // 兼容旧版 API，等价于忽略返回值的 Put
+	Search(key []byte) V      // 兼容旧版 API，key 不存在则返回 V 的零值
 	Size() int
-	Dump() map[string]interface{}
+	Dump() map[string]V
+	Range(start, end []byte, fn func(k []byte, v V) bool)
+	WalkPrefix(prefix []byte, fn func(k []byte, v V) bool)
+	HasPrefix(prefix []byte) bool
+	CountPrefix(prefix []byte) int
+
+	// 有序查找，k 为 nil 表示不存在满足条件的 key（包括空树）
+	// 存储的空 key 总是返回非 nil 的空切片 []byte{}，调用方需用 k == nil 而非 len(k) == 0 判断是否找到
+	Min() (k []byte, v V)
+	Max() (k []byte, v V)
+	Floor(key []byte) (k []byte, v V)   // 最后一个 <= key
+	Ceiling(key []byte) (k []byte, v V) // 第一个 >= key
+	Lower(key []byte) (k []byte, v V)   // 最后一个 < key
+	Higher(key []byte) (k []byte, v V)  // 第一个 > key
+	PopMin() (k []byte, v V)            // 删除并返回最小 key
+	PopMax() (k []byte, v V)            // 删除并返回最大 key
+
+	Iterator() Cursor[V]
+	All() iter.Seq2[[]byte, V]
+	Backward() iter.Seq2[[]byte, V]
+}
+
+// 按 key 字节序有序的双向游标
+// 新建的游标无效，需先 Seek 系列方法定位；迭代期间修改树的行为未定义
+type Cursor[V any] interface {
+	SeekToFirst() bool
+	SeekToLast() bool
+	Seek(key []byte) bool        // 定位到第一个 >= key 的位置
+	SeekForPrev(key []byte) bool // 定位到最后一个 <= key 的位置
+	Next() bool
+	Prev() bool
+	Valid() bool
+	Key() []byte // 返回的 key 与树共享内存，不可修改
+	Value() V
 }
+
+// 兼容存储 interface{} 的旧版 API
+type (
+	IndexTree = Tree[interface{}]
+	Iterator  = Cursor[interface{}]
+)
@@ -1,16 +1,20 @@
-package trees
+package trees_test
 
 import (
+	"fmt"
 	"github.com/k0kubun/pp"
 	"github.com/stretchr/testify/assert"
+	"sort"
+	"strings"
 	"testing"
+	"trees"
 	"trees/art"
 	"trees/radix"
 	"trees/utils"
 )
 
 func TestIndex(t *testing.T) {
-	for _, tree := range []IndexTree{
+	for _, tree := range []trees.IndexTree{
 		art.NewArtTree(),
 		radix.NewRadixTree(),
 	} {
@@ -27,6 +31,380 @@ func TestIndex(t *testing.T) {
 	}
 }
 
+func TestGenericIndex(t *testing.T) {
+	for _, tree := range []trees.Tree[int]{
+		art.New[int](),
+		radix.New[int](),
+	} {
+		m := make(map[string]int)
+		for i, s := range utils.RandStrs(100, 1, 10) {
+			m[s] = i
+			tree.Insert([]byte(s), i) // 重复 key 覆盖旧值
+		}
+		for k, v := range m {
+			got, ok := tree.Get([]byte(k))
+			assert.True(t, ok)
+			assert.Equal(t, v, got)
+		}
+
+		// 未命中返回零值
+		v, ok := tree.Get([]byte("0"))
+		assert.False(t, ok)
+		assert.Equal(t, 0, v)
+		assert.Equal(t, 0, tree.Search([]byte("0")))
+	}
+}
+
+func TestIndexContract(t *testing.T) {
+	for _, tree := range []trees.IndexTree{
+		art.NewArtTree(),
+		radix.NewRadixTree(),
+	} {
+		k := []byte("key")
+
+		// 存储的 nil 与不存在可区分
+		_, replaced := tree.Put(k, nil)
+		assert.False(t, replaced)
+		v, ok := tree.Get(k)
+		assert.True(t, ok)
+		assert.Nil(t, v)
+		_, ok = tree.Get([]byte("ke"))
+		assert.False(t, ok)
+
+		// Put 覆盖并返回旧值
+		old, replaced := tree.Put(k, 1)
+		assert.True(t, replaced)
+		assert.Nil(t, old)
+		old, replaced = tree.Put(k, 2)
+		assert.True(t, replaced)
+		assert.Equal(t, 1, old)
+
+		// PutIfAbsent 不覆盖
+		existing, loaded := tree.PutIfAbsent(k, 3)
+		assert.True(t, loaded)
+		assert.Equal(t, 2, existing)
+		assert.Equal(t, 2, tree.Search(k))
+		existing, loaded = tree.PutIfAbsent([]byte("other"), 4)
+		assert.False(t, loaded)
+		assert.Nil(t, existing)
+		assert.Equal(t, 2, tree.Size())
+
+		// Delete 返回被删除的值
+		old, ok = tree.Delete(k)
+		assert.True(t, ok)
+		assert.Equal(t, 2, old)
+		_, ok = tree.Delete(k)
+		assert.False(t, ok)
+		assert.Equal(t, 1, tree.Size())
+	}
+}
+
+func TestIndexIterator(t *testing.T) {
+	for _, tree := range []trees.IndexTree{
+		art.NewArtTree(),
+		radix.NewRadixTree(),
+	} {
+		m := make(map[string]interface{})
+		for _, s := range utils.RandStrs(1000, 1, 8) {
+			m[s] = s
+			tree.Insert([]byte(s), s)
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		i := 0
+		for k, v := range tree.All() {
+			assert.Equal(t, keys[i], string(k))
+			assert.Equal(t, m[keys[i]], v)
+			i++
+		}
+		assert.Equal(t, len(keys), i)
+
+		i = len(keys) - 1
+		for k := range tree.Backward() {
+			assert.Equal(t, keys[i], string(k))
+			i--
+		}
+		assert.Equal(t, -1, i)
+	}
+}
+
+func TestIndexRange(t *testing.T) {
+	for _, tree := range []trees.IndexTree{
+		art.NewArtTree(),
+		radix.NewRadixTree(),
+	} {
+		m := make(map[string]bool)
+		for _, s := range utils.RandStrs(1000, 1, 6) {
+			m[s] = true
+			tree.Insert([]byte(s), s)
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		bounds := utils.RandStrs(20, 1, 4)
+		for i := 0; i+1 < len(bounds); i += 2 {
+			start, end := bounds[i], bounds[i+1]
+			var want, got []string
+			for _, k := range keys {
+				if k >= start && k < end {
+					want = append(want, k)
+				}
+			}
+			tree.Range([]byte(start), []byte(end), func(k []byte, v interface{}) bool {
+				got = append(got, string(k))
+				return true
+			})
+			assert.Equal(t, want, got, "range [%s, %s)", start, end)
+		}
+
+		// 无界区间与提前结束
+		n := 0
+		tree.Range(nil, nil, func(k []byte, v interface{}) bool {
+			n++
+			return true
+		})
+		assert.Equal(t, len(keys), n)
+		var got []string
+		tree.Range([]byte(keys[10]), nil, func(k []byte, v interface{}) bool {
+			got = append(got, string(k))
+			return len(got) < 3
+		})
+		assert.Equal(t, keys[10:13], got)
+	}
+}
+
+func TestIndexPrefix(t *testing.T) {
+	for _, tree := range []trees.IndexTree{
+		art.NewArtTree(),
+		radix.NewRadixTree(),
+	} {
+		m := make(map[string]bool)
+		for _, s := range utils.RandStrs(1000, 1, 6) {
+			m[s] = true
+			tree.Insert([]byte(s), s)
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, prefix := range append(utils.RandStrs(50, 1, 3), "") {
+			var want, got []string
+			for _, k := range keys {
+				if strings.HasPrefix(k, prefix) {
+					want = append(want, k)
+				}
+			}
+			tree.WalkPrefix([]byte(prefix), func(k []byte, v interface{}) bool {
+				assert.Equal(t, string(k), v)
+				got = append(got, string(k))
+				return true
+			})
+			assert.Equal(t, want, got, "prefix %q", prefix)
+			assert.Equal(t, len(want), tree.CountPrefix([]byte(prefix)))
+			assert.Equal(t, len(want) > 0, tree.HasPrefix([]byte(prefix)))
+		}
+	}
+}
+
+func TestIndexOrdered(t *testing.T) {
+	for _, tree := range []trees.IndexTree{
+		art.NewArtTree(),
+		radix.NewRadixTree(),
+	} {
+		k, _ := tree.Min()
+		assert.Nil(t, k)
+		k, _ = tree.PopMax()
+		assert.Nil(t, k)
+
+		m := make(map[string]bool)
+		for _, s := range utils.RandStrs(1000, 1, 6) {
+			m[s] = true
+			tree.Insert([]byte(s), s)
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		k, _ = tree.Min()
+		assert.Equal(t, keys[0], string(k))
+		k, _ = tree.Max()
+		assert.Equal(t, keys[len(keys)-1], string(k))
+
+		// 以已存在和不存在的 key 为界查找相邻 key
+		bounds := append(utils.RandStrs(50, 1, 4), keys[:50]...)
+		at := func(i int) string {
+			if i < 0 || i >= len(keys) {
+				return ""
+			}
+			return keys[i]
+		}
+		for _, b := range bounds {
+			i := sort.SearchStrings(keys, b)
+			exact := i < len(keys) && keys[i] == b
+			floor, higher := i-1, i
+			if exact {
+				floor, higher = i, i+1
+			}
+			k, v := tree.Floor([]byte(b))
+			assert.Equal(t, at(floor), string(k), "floor %q", b)
+			if k != nil {
+				assert.Equal(t, string(k), v)
+			}
+			k, _ = tree.Ceiling([]byte(b))
+			assert.Equal(t, at(i), string(k), "ceiling %q", b)
+			k, _ = tree.Lower([]byte(b))
+			assert.Equal(t, at(i-1), string(k), "lower %q", b)
+			k, _ = tree.Higher([]byte(b))
+			assert.Equal(t, at(higher), string(k), "higher %q", b)
+		}
+
+		// 两端交替弹出直至为空
+		for i, j := 0, len(keys)-1; i <= j; i, j = i+1, j-1 {
+			k, v := tree.PopMin()
+			assert.Equal(t, keys[i], string(k))
+			assert.Equal(t, keys[i], v)
+			if i < j {
+				k, _ = tree.PopMax()
+				assert.Equal(t, keys[j], string(k))
+			}
+		}
+		assert.Equal(t, 0, tree.Size())
+		k, _ = tree.PopMin()
+		assert.Nil(t, k)
+	}
+}
+
+// 与逐个截短 key 后 Get 的结果一致
+func TestIndexLongestPrefix(t *testing.T) {
+	keys := append(utils.RandStrs(500, 0, 6), "", "a", "ab", "abc", "abcdefghijklm", "abcdefghijklmnop")
+	for _, tree := range []interface {
+		trees.Tree[int]
+		LongestPrefix(key []byte) ([]byte, int, bool)
+	}{
+		art.New[int](),
+		art.New[int](art.WithPrefixLen(0)), // 前缀完全乐观跳过，只由叶子校验
+		radix.New[int](),
+	} {
+		for i, k := range keys {
+			if i%4 != 0 {
+				tree.Insert([]byte(k), len(k))
+			}
+		}
+		for _, q := range append(keys, "abcdefghijklmn", "abcdefghijklx", "zzzzzzzz") {
+			var want []byte
+			for n := len(q); n >= 0; n-- {
+				if _, ok := tree.Get([]byte(q[:n])); ok {
+					want = []byte(q[:n])
+					break
+				}
+			}
+			k, v, ok := tree.LongestPrefix([]byte(q))
+			assert.Equal(t, ok, want != nil, "%T %q", tree, q)
+			assert.Equal(t, k, want, "%T %q", tree, q)
+			if ok {
+				assert.Equal(t, v, len(k))
+			}
+		}
+	}
+}
+
+// 与逐个删除以 prefix 为前缀的 key 的结果一致，删除后树依旧合法
+func TestIndexDeletePrefix(t *testing.T) {
+	keys := append(utils.RandStrs(2000, 0, 8), "", "a", "ab", "abc", "abcdefghijklm", "abcdefghijklmnop")
+	prefixes := append(utils.RandStrs(100, 1, 3), "abcdefghijklmn", "abcdefghijklmnopq", "abcdefghijk", "ab", "")
+	for _, tree := range []interface {
+		trees.Tree[int]
+		DeletePrefix(prefix []byte) int
+		Clear()
+		Validate() error
+	}{
+		art.New[int](),
+		art.New[int](art.WithPrefixLen(0)),
+		art.New[int](art.WithShrinkHysteresis(2)),
+		radix.New[int](),
+	} {
+		m := make(map[string]int)
+		for _, k := range keys {
+			tree.Insert([]byte(k), len(k))
+			m[k] = len(k)
+		}
+		for _, p := range prefixes {
+			want := 0
+			for k := range m {
+				if strings.HasPrefix(k, p) {
+					delete(m, k)
+					want++
+				}
+			}
+			assert.Equal(t, want, tree.DeletePrefix([]byte(p)), "%T %q", tree, p)
+			assert.Equal(t, len(m), tree.Size())
+			assert.Equal(t, m, tree.Dump())
+			assert.NoError(t, tree.Validate())
+		}
+		assert.Equal(t, 0, tree.DeletePrefix(nil))
+
+		// 清空后可以继续使用
+		tree.Insert([]byte("abc"), 3)
+		tree.Clear()
+		assert.Equal(t, 0, tree.Size())
+		assert.Empty(t, tree.Dump())
+		tree.Insert([]byte("abc"), 3)
+		assert.Equal(t, 3, tree.Search([]byte("abc")))
+	}
+}
+
+// 同一数据集在 art 和 radix 上的结构对比：go test -run Stats -v .
+func TestIndexStats(t *testing.T) {
+	keys := []string{"romane", "romanus", "romulus", "rub", "rubens", "ruber", "rubicon", "rubicundus"}
+	for _, c := range []struct {
+		tree interface {
+			trees.IndexTree
+			Stats() trees.Stats
+		}
+		nodes                    map[string]int
+		depth, fanout, prefixLen []int
+		mergedBytes              int // 写入并删除 roma 后多出的字节数
+	}{
+		// root(r) -> o(m) -> a(n) -> {romane, romanus}，u(b) 含叶子 rub -> e() -> {rubens, ruber}，i(c) -> {rubicon, rubicundus}
+		{art.NewArtTree(), map[string]int{"LEAF": 8, "NODE4": 6}, []int{0, 0, 2, 6}, []int{0, 0, 6}, []int{1, 5}, 0},
+		// root -> r -> om -> an -> {e, us}，ulus；ub(mixed) -> e -> {ns, r}，ic -> {on, undus}
+		{radix.NewRadixTree(), map[string]int{"leaf": 7, "mixed": 1, "prefix": 6}, []int{0, 0, 1, 1, 6}, []int{0, 1, 6}, []int{0, 4, 7, 0, 1, 1}, 2},
+	} {
+		for _, k := range keys {
+			c.tree.Insert([]byte(k), nil)
+		}
+		s := c.tree.Stats()
+		assert.Equal(t, len(keys), s.Keys)
+		assert.Equal(t, c.nodes, s.Nodes)
+		assert.Equal(t, c.depth, s.Depth)
+		assert.Equal(t, c.fanout, s.Fanout)
+		assert.Equal(t, c.prefixLen, s.PrefixLen)
+		assert.Equal(t, 0, s.OptimisticPrefixes)
+		assert.Equal(t, float64(s.Bytes)/float64(s.Keys), s.BytesPerKey)
+		assert.True(t, strings.HasPrefix(s.String(), fmt.Sprintf("keys: %d, bytes: %d", s.Keys, s.Bytes)))
+
+		// 写入后删除 roma：radix 的 an 先分裂为 a(mixed) 和 n，删除后再合并为新分配的 an，多出 2 字节的前缀数组
+		// art 的节点内嵌前缀，roma 的叶子被删除后不占用内存
+		c.tree.Insert([]byte("roma"), nil)
+		c.tree.Delete([]byte("roma"))
+		merged := c.tree.Stats()
+		assert.Equal(t, c.nodes, merged.Nodes)
+		assert.Equal(t, c.prefixLen, merged.PrefixLen)
+		assert.Equal(t, s.Bytes+c.mergedBytes, merged.Bytes)
+	}
+}
+
 func TestArt(t *testing.T) {
 	tree := art.NewArtTree()
 	tree.Insert([]byte("12345678abcd"), 1)
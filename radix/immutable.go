@@ -0,0 +1,269 @@
+package radix
+
+import (
+	"iter"
+	"slices"
+	"trees"
+	"trees/utils"
+)
+
+// 不可变的基数树，即持久化数据结构
+// 写操作从 root 开始拷贝到目标 key 路径上的节点，生成新版本，新旧版本共享未修改的子树
+// 已有版本永远不会被修改，持有旧版本的读者无需加锁，始终看到一致的内容；可配合 atomic.Pointer 发布最新版本
+type Immutable[V any] struct {
+	tree    Tree[V]     // 只读，所有读操作复用 Tree 的实现
+	watches *watches[V] // 所有版本共享
+}
+
+func NewImmutable[V any]() *Immutable[V] {
+	return &Immutable[V]{tree: *New[V](), watches: &watches[V]{}}
+}
+
+// 开启基于当前版本的事务
+func (t *Immutable[V]) Txn() *Txn[V] {
+	return &Txn[V]{root: t.tree.root, size: t.tree.size, watches: t.watches}
+}
+
+// 新增或更新，返回新版本
+func (t *Immutable[V]) Insert(key []byte, val V) *Immutable[V] {
+	next, _, _ := t.Put(key, val)
+	return next
+}
+
+// 单个 key 的事务，replaced 标识 key 是否已存在，old 为被覆盖的旧值
+func (t *Immutable[V]) Put(key []byte, val V) (next *Immutable[V], old V, replaced bool) {
+	txn := t.Txn()
+	old, replaced = txn.Put(key, val)
+	return txn.Commit(), old, replaced
+}
+
+// key 已存在则返回当前版本本身，existing 为已存在的值
+func (t *Immutable[V]) PutIfAbsent(key []byte, val V) (next *Immutable[V], existing V, loaded bool) {
+	txn := t.Txn()
+	if existing, loaded = txn.PutIfAbsent(key, val); loaded {
+		return t, existing, true
+	}
+	return txn.Commit(), existing, false
+}
+
+// key 不存在则返回当前版本本身
+func (t *Immutable[V]) Delete(key []byte) (next *Immutable[V], old V, ok bool) {
+	txn := t.Txn()
+	if old, ok = txn.Delete(key); !ok {
+		return t, old, false
+	}
+	return txn.Commit(), old, true
+}
+
+// 批量修改，Commit 前的写入对其它版本不可见，Commit 后原子地生成包含所有修改的新版本
+// 路径上的节点在事务内首次修改时拷贝，之后的修改直接在拷贝上原地进行，同一路径上的多次写入只拷贝一次
+// 事务本身不是并发安全的，只能由一个 goroutine 使用
+type Txn[V any] struct {
+	root           *node[V]
+	size           int
+	watches        *watches[V]
+	written        map[*node[V]]struct{} // 本事务拷贝或新建的节点，不被任何已提交的版本引用，可以原地修改
+	replacedNodes  []*node[V]            // 被拷贝、合并的旧节点，提交时通知其 Watch
+	replacedLeaves []*leaf[V]            // 被替换、删除的旧叶子，提交时通知其 Watch
+}
+
+// 返回 n 的可写版本，n 不是本事务创建的节点则拷贝一份
+// 边数组会被原地增删、排序，需拷贝；前缀只会被重新切片，叶子只会被整体替换，均可共享
+func (t *Txn[V]) writable(n *node[V]) *node[V] {
+	if t.isWritten(n) {
+		return n
+	}
+	c := &node[V]{leaf: n.leaf, prefix: n.prefix, edges: slices.Clone(n.edges)}
+	t.track(c)
+	t.replacedNodes = append(t.replacedNodes, n)
+	return c
+}
+
+func (t *Txn[V]) isWritten(n *node[V]) bool {
+	_, ok := t.written[n]
+	return ok
+}
+
+func (t *Txn[V]) track(n *node[V]) *node[V] {
+	if t.written == nil {
+		t.written = make(map[*node[V]]struct{})
+	}
+	t.written[n] = struct{}{}
+	return n
+}
+
+// 写入的 key 在事务内立即可见
+func (t *Txn[V]) Get(key []byte) (v V, ok bool) {
+	return (&Tree[V]{root: t.root}).Get(key)
+}
+
+func (t *Txn[V]) Size() int {
+	return t.size
+}
+
+func (t *Txn[V]) Insert(key []byte, val V) {
+	t.Put(key, val)
+}
+
+func (t *Txn[V]) Put(key []byte, val V) (old V, replaced bool) {
+	return t.insert(key, val, true)
+}
+
+func (t *Txn[V]) PutIfAbsent(key []byte, val V) (existing V, loaded bool) {
+	if existing, loaded = t.Get(key); loaded {
+		return existing, true // 不修改则无需拷贝路径
+	}
+	return t.insert(key, val, false)
+}
+
+// 与 Tree.insert 相同的下沉和分裂，途经的节点先替换为可写版本
+func (t *Txn[V]) insert(key []byte, val V, overwrite bool) (old V, ok bool) {
+	originKey := make([]byte, len(key))
+	copy(originKey, key)
+	newLeaf := &leaf[V]{key: originKey, val: val}
+	key = originKey // 节点前缀均切自拷贝后的 key，不能引用调用方的内存
+
+	t.root = t.writable(t.root)
+	cur := t.root
+	for {
+		// 1. 恰好在当前节点结束，叶子整体替换，旧版本的叶子不变
+		if len(key) == 0 {
+			if cur.isLeafNode() {
+				old = cur.leaf.val
+				if overwrite {
+					t.replacedLeaves = append(t.replacedLeaves, cur.leaf)
+					cur.leaf = newLeaf
+				}
+				return old, true
+			}
+			cur.leaf = newLeaf
+			t.size++
+			return
+		}
+
+		// 2. 没有对应的边则新建叶子节点
+		child := cur.searchEdge(key[0])
+		if child == nil {
+			cur.addEdge(edge[V]{k: key[0], n: t.track(&node[V]{leaf: newLeaf, prefix: key})})
+			t.size++
+			return
+		}
+
+		// 3. 前缀被完全覆盖则继续下沉，否则分裂，二者都需修改子节点
+		child = t.writable(child)
+		cur.replaceEdge(key[0], child)
+		commonLen := utils.LongestPrefix(child.prefix, key)
+		if commonLen == len(child.prefix) {
+			cur = child
+			key = key[commonLen:]
+			continue
+		}
+
+		commonNode := t.track(&node[V]{prefix: key[:commonLen]})
+		cur.replaceEdge(key[0], commonNode)
+		commonNode.addEdge(edge[V]{k: child.prefix[commonLen], n: child})
+		child.prefix = child.prefix[commonLen:]
+
+		key = key[commonLen:]
+		if len(key) == 0 {
+			commonNode.leaf = newLeaf
+			t.size++
+			return
+		}
+		commonNode.addEdge(edge[V]{k: key[0], n: t.track(&node[V]{prefix: key, leaf: newLeaf})})
+		t.size++
+		return
+	}
+}
+
+// 与 Tree.Delete 相同的删除与合并，key 不存在时不拷贝任何节点
+func (t *Txn[V]) Delete(key []byte) (old V, ok bool) {
+	if old, ok = t.Get(key); !ok {
+		return
+	}
+
+	var parent *node[V]
+	var k byte
+	t.root = t.writable(t.root)
+	cur := t.root
+	for len(key) > 0 {
+		parent, k = cur, key[0]
+		cur = t.writable(cur.searchEdge(k))
+		parent.replaceEdge(k, cur)
+		key = key[len(cur.prefix):]
+	}
+
+	t.replacedLeaves = append(t.replacedLeaves, cur.leaf)
+	cur.leaf = nil
+	t.size--
+	switch len(cur.edges) {
+	case 0:
+		if parent != nil {
+			parent.deleteEdge(k)
+		}
+	case 1:
+		if cur != t.root {
+			t.merge(cur)
+		}
+	}
+	if parent != nil && !parent.isLeafNode() && len(parent.edges) == 1 && parent != t.root {
+		t.merge(parent)
+	}
+	return old, true
+}
+
+// 上浮唯一子节点，n 接管了子节点的边数组，子节点可能属于旧版本，需拷贝
+// 子节点不再存在，Watch 它的调用方同样需要通知
+func (t *Txn[V]) merge(n *node[V]) {
+	if child := n.edges[0].n; !t.isWritten(child) {
+		t.replacedNodes = append(t.replacedNodes, child)
+	}
+	n.replaceByOnlyChild()
+	n.edges = slices.Clone(n.edges)
+}
+
+// 生成包含事务内所有修改的新版本，并关闭被替换的节点和叶子的 Watch channel
+// 之后事务仍可继续使用，新的修改重新拷贝节点，不会影响已提交的版本
+func (t *Txn[V]) Commit() *Immutable[V] {
+	next := &Immutable[V]{tree: Tree[V]{root: t.root, size: t.size}, watches: t.watches}
+	t.watches.nodes.close(t.replacedNodes)
+	t.watches.leaves.close(t.replacedLeaves)
+	t.written, t.replacedNodes, t.replacedLeaves = nil, nil, nil
+	return next
+}
+
+// 只读操作，与 Tree 的语义相同
+
+func (t *Immutable[V]) Get(key []byte) (v V, ok bool)      { return t.tree.Get(key) }
+func (t *Immutable[V]) Search(key []byte) V                { return t.tree.Search(key) }
+func (t *Immutable[V]) Size() int                          { return t.tree.Size() }
+func (t *Immutable[V]) Dump() map[string]V                 { return t.tree.Dump() }
+func (t *Immutable[V]) Min() (k []byte, v V)               { return t.tree.Min() }
+func (t *Immutable[V]) Max() (k []byte, v V)               { return t.tree.Max() }
+func (t *Immutable[V]) Floor(key []byte) (k []byte, v V)   { return t.tree.Floor(key) }
+func (t *Immutable[V]) Ceiling(key []byte) (k []byte, v V) { return t.tree.Ceiling(key) }
+func (t *Immutable[V]) Lower(key []byte) (k []byte, v V)   { return t.tree.Lower(key) }
+func (t *Immutable[V]) Higher(key []byte) (k []byte, v V)  { return t.tree.Higher(key) }
+func (t *Immutable[V]) HasPrefix(prefix []byte) bool       { return t.tree.HasPrefix(prefix) }
+func (t *Immutable[V]) CountPrefix(prefix []byte) int      { return t.tree.CountPrefix(prefix) }
+func (t *Immutable[V]) Iterator() trees.Cursor[V]          { return t.tree.Iterator() }
+func (t *Immutable[V]) All() iter.Seq2[[]byte, V]          { return t.tree.All() }
+func (t *Immutable[V]) Backward() iter.Seq2[[]byte, V]     { return t.tree.Backward() }
+func (t *Immutable[V]) Validate() error                    { return t.tree.Validate() }
+func (t *Immutable[V]) Stats() trees.Stats                 { return t.tree.Stats() }
+
+func (t *Immutable[V]) LongestPrefix(key []byte) (k []byte, v V, ok bool) {
+	return t.tree.LongestPrefix(key)
+}
+
+func (t *Immutable[V]) WalkPath(key []byte, fn func(k []byte, v V) bool) {
+	t.tree.WalkPath(key, fn)
+}
+
+func (t *Immutable[V]) Range(start, end []byte, fn func(k []byte, v V) bool) {
+	t.tree.Range(start, end, fn)
+}
+
+func (t *Immutable[V]) WalkPrefix(prefix []byte, fn func(k []byte, v V) bool) {
+	t.tree.WalkPrefix(prefix, fn)
+}
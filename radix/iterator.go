@@ -0,0 +1,201 @@
+package radix
+
+import (
+	"bytes"
+	"iter"
+	"sort"
+	"trees"
+	"trees/utils"
+)
+
+var _ trees.Tree[int] = (*Tree[int])(nil)
+var _ trees.IndexTree = (*RadixTree)(nil)
+
+// 游标下沉路径上的节点，idx 为当前所在边的索引，-1 表示位于节点自身的叶子
+type frame[V any] struct {
+	n   *node[V]
+	idx int
+}
+
+// 有序双向迭代器
+// 节点自身的叶子是其所有子节点 key 的前缀，按字节序排在所有边之前
+type Iterator[V any] struct {
+	tree  *Tree[V]
+	stack []frame[V]
+}
+
+func (t *Tree[V]) Iterator() trees.Cursor[V] {
+	return &Iterator[V]{tree: t}
+}
+
+// 升序遍历
+func (t *Tree[V]) All() iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		it := &Iterator[V]{tree: t}
+		for ok := it.SeekToFirst(); ok; ok = it.Next() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// 降序遍历
+func (t *Tree[V]) Backward() iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		it := &Iterator[V]{tree: t}
+		for ok := it.SeekToLast(); ok; ok = it.Prev() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+func (it *Iterator[V]) SeekToFirst() bool {
+	it.stack = it.stack[:0]
+	return it.first(it.tree.root)
+}
+
+func (it *Iterator[V]) SeekToLast() bool {
+	it.stack = it.stack[:0]
+	return it.last(it.tree.root)
+}
+
+// 定位到第一个 >= key 的叶子
+func (it *Iterator[V]) Seek(key []byte) bool {
+	it.stack = it.stack[:0]
+	cur := it.tree.root
+	for {
+		// cur 的完整路径恰好是 key，则 cur 的叶子及其整棵子树都 >= key
+		if len(key) == 0 {
+			return it.first(cur)
+		}
+
+		// cur 自身的叶子是 key 的真前缀，比 key 小，直接跳过
+		i := sort.Search(len(cur.edges), func(i int) bool {
+			return cur.edges[i].k >= key[0]
+		})
+		if i == len(cur.edges) || cur.edges[i].k != key[0] {
+			it.stack = append(it.stack, frame[V]{n: cur, idx: i - 1})
+			return it.next() // 取第一条比 key[0] 大的边
+		}
+
+		it.stack = append(it.stack, frame[V]{n: cur, idx: i})
+		child := cur.edges[i].n
+		commonLen := utils.LongestPrefix(child.prefix, key)
+		if commonLen == len(child.prefix) {
+			key = key[commonLen:]
+			cur = child
+			continue
+		}
+		if commonLen == len(key) || key[commonLen] < child.prefix[commonLen] {
+			return it.first(child) // 整棵子树都大于 key
+		}
+		return it.next() // 整棵子树都小于 key
+	}
+}
+
+// 定位到最后一个 <= key 的叶子
+func (it *Iterator[V]) SeekForPrev(key []byte) bool {
+	if !it.Seek(key) {
+		return it.SeekToLast()
+	}
+	if bytes.Equal(it.Key(), key) {
+		return true
+	}
+	return it.Prev()
+}
+
+func (it *Iterator[V]) Next() bool {
+	if !it.Valid() {
+		return false
+	}
+	return it.next()
+}
+
+func (it *Iterator[V]) Prev() bool {
+	if !it.Valid() {
+		return false
+	}
+	return it.prev()
+}
+
+func (it *Iterator[V]) Valid() bool {
+	return len(it.stack) > 0
+}
+
+func (it *Iterator[V]) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.stack[len(it.stack)-1].n.leaf.key
+}
+
+func (it *Iterator[V]) Value() (v V) {
+	if !it.Valid() {
+		return v
+	}
+	return it.stack[len(it.stack)-1].n.leaf.val
+}
+
+// 从 n 一路向左下沉，遇到的第一个叶子即子树最小 key
+func (it *Iterator[V]) first(n *node[V]) bool {
+	for {
+		if n.isLeafNode() {
+			it.stack = append(it.stack, frame[V]{n: n, idx: -1})
+			return true
+		}
+		if !n.isPrefixNode() {
+			return false // 空树的 root
+		}
+		it.stack = append(it.stack, frame[V]{n: n, idx: 0})
+		n = n.edges[0].n
+	}
+}
+
+// 从 n 一路向右下沉，最后一条边末端的叶子即子树最大 key
+func (it *Iterator[V]) last(n *node[V]) bool {
+	for {
+		if n.isPrefixNode() {
+			it.stack = append(it.stack, frame[V]{n: n, idx: len(n.edges) - 1})
+			n = n.edges[len(n.edges)-1].n
+			continue
+		}
+		if n.isLeafNode() {
+			it.stack = append(it.stack, frame[V]{n: n, idx: -1})
+			return true
+		}
+		return false
+	}
+}
+
+// 回溯到第一个还有下一条边的节点，再取该边子树的最小 key
+func (it *Iterator[V]) next() bool {
+	for len(it.stack) > 0 {
+		top := &it.stack[len(it.stack)-1]
+		if top.idx+1 < len(top.n.edges) {
+			top.idx++
+			return it.first(top.n.edges[top.idx].n)
+		}
+		it.stack = it.stack[:len(it.stack)-1]
+	}
+	return false
+}
+
+// 回溯到第一个还有上一条边或自身叶子的节点，再取其最大 key
+func (it *Iterator[V]) prev() bool {
+	for len(it.stack) > 0 {
+		top := &it.stack[len(it.stack)-1]
+		switch {
+		case top.idx > 0:
+			top.idx--
+			return it.last(top.n.edges[top.idx].n)
+		case top.idx == 0 && top.n.isLeafNode():
+			top.idx = -1
+			return true
+		}
+		it.stack = it.stack[:len(it.stack)-1]
+	}
+	return false
+}
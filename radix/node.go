@@ -2,34 +2,34 @@ package radix
 
 import "sort"
 
-type leaf struct {
+type leaf[V any] struct {
 	key []byte
-	val interface{}
+	val V
 }
 
 // 混合了前缀和叶子的节点
 // 若 leaf 有值则为叶子节点
 // 若 prefix 有值则为前缀节点
 // 二者均有值则为混合节点
-type node struct {
-	leaf   *leaf
+type node[V any] struct {
+	leaf   *leaf[V]
 	prefix []byte
-	edges  edges
+	edges  edges[V]
 }
 
-func (n *node) isLeafNode() bool {
+func (n *node[V]) isLeafNode() bool {
 	return n.leaf != nil
 }
 
-func (n *node) isPrefixNode() bool {
+func (n *node[V]) isPrefixNode() bool {
 	return len(n.edges) > 0
 }
 
-func (n *node) isMixedNode() bool {
+func (n *node[V]) isMixedNode() bool {
 	return n.isLeafNode() && n.isPrefixNode()
 }
 
-func (n *node) binSearch(k byte) int {
+func (n *node[V]) binSearch(k byte) int {
 	l := len(n.edges)
 	i := sort.Search(l, func(i int) bool {
 		return n.edges[i].k >= k
@@ -40,19 +40,19 @@ func (n *node) binSearch(k byte) int {
 	return -1
 }
 
-func (n *node) searchEdge(label byte) *node {
+func (n *node[V]) searchEdge(label byte) *node[V] {
 	if i := n.binSearch(label); i != -1 {
 		return n.edges[i].n // 返回前缀边的子节点
 	}
 	return nil
 }
 
-func (n *node) addEdge(e edge) {
+func (n *node[V]) addEdge(e edge[V]) {
 	n.edges = append(n.edges, e)
 	n.edges.resort()
 }
 
-func (n *node) replaceEdge(k byte, newNode *node) {
+func (n *node[V]) replaceEdge(k byte, newNode *node[V]) {
 	if i := n.binSearch(k); i != -1 {
 		n.edges[i].n = newNode
 		return
@@ -60,11 +60,11 @@ func (n *node) replaceEdge(k byte, newNode *node) {
 	panic("replace unexpected")
 }
 
-func (n *node) deleteEdge(label byte) {
+func (n *node[V]) deleteEdge(label byte) {
 	if i := n.binSearch(label); i != -1 {
 		// 保持有序
 		copy(n.edges[i:], n.edges[i+1:])
-		n.edges[len(n.edges)-1] = edge{}
+		n.edges[len(n.edges)-1] = edge[V]{}
 		n.edges = n.edges[:len(n.edges)-1]
 		return
 	}
@@ -72,33 +72,48 @@ func (n *node) deleteEdge(label byte) {
 }
 
 // 提升唯一子节点
-func (n *node) replaceByOnlyChild() {
+func (n *node[V]) replaceByOnlyChild() {
 	child := n.edges[0].n
-	n.prefix = append(n.prefix, child.prefix...)
+	// prefix 与叶子 key 共享底层数组，直接 append 会覆写其后的字节，需拼接到新数组
+	prefix := make([]byte, 0, len(n.prefix)+len(child.prefix))
+	n.prefix = append(append(prefix, n.prefix...), child.prefix...)
 	n.leaf = child.leaf
 	n.edges = child.edges
 }
 
-type edge struct {
-	k byte  // 边的 byte
-	n *node // 末端节点
+// 按字节序遍历 n 子树下的所有叶子，自身的叶子先于所有子节点，fn 返回 false 则提前结束
+func (n *node[V]) walk(fn func(k []byte, v V) bool) bool {
+	if n.isLeafNode() && !fn(n.leaf.key, n.leaf.val) {
+		return false
+	}
+	for _, e := range n.edges {
+		if !e.n.walk(fn) {
+			return false
+		}
+	}
+	return true
+}
+
+type edge[V any] struct {
+	k byte     // 边的 byte
+	n *node[V] // 末端节点
 }
 
 // 方便边的搜索
-type edges []edge
+type edges[V any] []edge[V]
 
-func (e edges) Len() int {
+func (e edges[V]) Len() int {
 	return len(e)
 }
 
-func (e edges) Less(i, j int) bool {
+func (e edges[V]) Less(i, j int) bool {
 	return e[i].k < e[j].k
 }
 
-func (e edges) Swap(i, j int) {
+func (e edges[V]) Swap(i, j int) {
 	e[i], e[j] = e[j], e[i]
 }
 
-func (e edges) resort() {
+func (e edges[V]) resort() {
 	sort.Sort(e)
 }
@@ -5,26 +5,49 @@ import (
 	"trees/utils"
 )
 
-// 基数树
-type RadixTree struct {
-	root *node
+// 值类型为 V 的基数树
+type Tree[V any] struct {
+	root *node[V]
 	size int
 }
 
-func NewRadixTree() *RadixTree {
-	return &RadixTree{
-		root: &node{}, // root 始终空
+// 兼容存储 interface{} 的旧版 API
+type RadixTree = Tree[interface{}]
+
+func New[V any]() *Tree[V] {
+	return &Tree[V]{
+		root: &node[V]{}, // root 始终空
 		size: 0,
 	}
 }
 
-// 新增或更新
-func (t *RadixTree) Insert(key []byte, val interface{}) {
+func NewRadixTree() *RadixTree {
+	return New[interface{}]()
+}
+
+// 新增或更新，等价于忽略返回值的 Put
+func (t *Tree[V]) Insert(key []byte, val V) {
+	t.Put(key, val)
+}
+
+// 新增或更新，replaced 标识 key 是否已存在，old 为被覆盖的旧值
+func (t *Tree[V]) Put(key []byte, val V) (old V, replaced bool) {
+	return t.insert(key, val, true)
+}
+
+// 仅在 key 不存在时写入，loaded 标识 key 是否已存在，existing 为已存在的值
+func (t *Tree[V]) PutIfAbsent(key []byte, val V) (existing V, loaded bool) {
+	return t.insert(key, val, false)
+}
+
+// key 已存在时返回其旧值，并根据 overwrite 决定是否覆盖
+func (t *Tree[V]) insert(key []byte, val V, overwrite bool) (old V, ok bool) {
 	originKey := make([]byte, len(key))
 	copy(originKey, key)
-	newLeaf := &leaf{key: originKey, val: val}
+	newLeaf := &leaf[V]{key: originKey, val: val}
+	key = originKey // 节点前缀均切自拷贝后的 key，不能引用调用方的内存
 
-	var parent *node
+	var parent *node[V]
 	cur := t.root
 
 	for {
@@ -32,8 +55,11 @@ func (t *RadixTree) Insert(key []byte, val interface{}) {
 		// 修改 root 节点的值，或切割后发现是前缀节点，则更新值或添加叶子节点
 		if len(key) == 0 {
 			if cur.isLeafNode() {
-				cur.leaf.val = val
-				return
+				old = cur.leaf.val
+				if overwrite {
+					cur.leaf.val = val
+				}
+				return old, true
 			}
 			cur.leaf = newLeaf
 			t.size++
@@ -45,9 +71,9 @@ func (t *RadixTree) Insert(key []byte, val interface{}) {
 
 		// 1. 没有边指向叶子节点的边则创建
 		if cur == nil {
-			e := edge{
+			e := edge[V]{
 				k: key[0],
-				n: &node{
+				n: &node[V]{
 					leaf:   newLeaf,
 					prefix: key,
 					edges:  nil,
@@ -67,11 +93,11 @@ func (t *RadixTree) Insert(key []byte, val interface{}) {
 		}
 
 		// 2.2. 不覆盖则分裂当前节点
-		commonNode := &node{
+		commonNode := &node[V]{
 			prefix: key[:commonLen],
 		}
 		parent.replaceEdge(key[0], commonNode) // 变更指向到新父节点
-		commonNode.addEdge(edge{
+		commonNode.addEdge(edge[V]{
 			k: cur.prefix[commonLen],
 			n: cur, // 将当前节点挪到子节点
 		})
@@ -84,9 +110,9 @@ func (t *RadixTree) Insert(key []byte, val interface{}) {
 			return
 		}
 
-		commonNode.addEdge(edge{
+		commonNode.addEdge(edge[V]{
 			k: key[0],
-			n: &node{
+			n: &node[V]{
 				prefix: key,
 				leaf:   newLeaf,
 			},
@@ -96,9 +122,9 @@ func (t *RadixTree) Insert(key []byte, val interface{}) {
 	}
 }
 
-// 删除
-func (t *RadixTree) Delete(key []byte) bool {
-	var parent *node
+// 删除，ok 标识 key 是否存在，old 为被删除的值
+func (t *Tree[V]) Delete(key []byte) (old V, ok bool) {
+	var parent *node[V]
 	var k byte
 	cur := t.root
 
@@ -106,7 +132,7 @@ func (t *RadixTree) Delete(key []byte) bool {
 	for {
 		if len(key) == 0 {
 			if !cur.isLeafNode() {
-				return false // 必须是叶子节点，避免删除
+				return // 必须是叶子节点，避免删除
 			}
 			break // bingo
 		}
@@ -115,11 +141,11 @@ func (t *RadixTree) Delete(key []byte) bool {
 		k = key[0]
 		cur = cur.searchEdge(k)
 		if cur == nil {
-			return false // 边不存在
+			return // 边不存在
 		}
 
 		if !bytes.HasPrefix(key, cur.prefix) {
-			return false // 边存在，但节点不存在
+			return // 边存在，但节点不存在
 		}
 
 		// 切割前缀，继续向下查找
@@ -127,6 +153,7 @@ func (t *RadixTree) Delete(key []byte) bool {
 	}
 
 	// 2. 删除叶子节点
+	old = cur.leaf.val
 	cur.leaf = nil
 	t.size--
 
@@ -138,7 +165,9 @@ func (t *RadixTree) Delete(key []byte) bool {
 		}
 	case 1:
 		// 2.2. 当前节点是混合节点，且只有一个子节点，删除后要上浮该子节点
-		cur.replaceByOnlyChild()
+		if cur != t.root { // 根节点同样不能被替换
+			cur.replaceByOnlyChild()
+		}
 	}
 
 	// 2.3. 若父节点只是前缀节点，且只有一个子节点，要继续上浮
@@ -147,34 +176,82 @@ func (t *RadixTree) Delete(key []byte) bool {
 			parent.replaceByOnlyChild()
 		}
 	}
-	return true
+	return old, true
+}
+
+// 查找，不存在则返回 V 的零值
+func (t *Tree[V]) Search(key []byte) V {
+	v, _ := t.Get(key)
+	return v
 }
 
-// 查找
-func (t *RadixTree) Search(key []byte) interface{} {
+// 查找，ok 标识 key 是否存在
+func (t *Tree[V]) Get(key []byte) (v V, ok bool) {
 	cur := t.root
 	for {
 		if len(key) == 0 {
 			if !cur.isLeafNode() {
-				return nil
+				return v, false
 			}
-			return cur.leaf.val
+			return cur.leaf.val, true
 		}
 
 		cur = cur.searchEdge(key[0])
 		if cur == nil {
-			return nil
+			return v, false
 		}
 		if !bytes.HasPrefix(key, cur.prefix) {
-			return nil
+			return v, false
 		}
 		key = key[len(cur.prefix):]
 	}
 }
 
-func (t *RadixTree) Dump() map[string]interface{} {
-	var traverse func(n *node, m map[string]interface{})
-	traverse = func(n *node, m map[string]interface{}) {
+// 最长的、是 key 前缀的已存储 key，不存在则 ok 为 false
+// 沿 key 下沉，途经的叶子节点和混合节点都是候选的前缀，最后一个即最长
+func (t *Tree[V]) LongestPrefix(key []byte) (k []byte, v V, ok bool) {
+	var last *leaf[V]
+	cur := t.root
+	for {
+		if cur.isLeafNode() {
+			last = cur.leaf
+		}
+		if len(key) == 0 {
+			break
+		}
+		cur = cur.searchEdge(key[0])
+		if cur == nil || !bytes.HasPrefix(key, cur.prefix) {
+			break
+		}
+		key = key[len(cur.prefix):]
+	}
+	if last == nil {
+		return nil, v, false
+	}
+	return last.key, last.val, true
+}
+
+// 自 root 向下依次访问每个是 key 前缀的已存储 key，即 key 路径上的叶子节点和混合节点，fn 返回 false 则提前结束
+func (t *Tree[V]) WalkPath(key []byte, fn func(k []byte, v V) bool) {
+	cur := t.root
+	for {
+		if cur.isLeafNode() && !fn(cur.leaf.key, cur.leaf.val) {
+			return
+		}
+		if len(key) == 0 {
+			return
+		}
+		cur = cur.searchEdge(key[0])
+		if cur == nil || !bytes.HasPrefix(key, cur.prefix) {
+			return
+		}
+		key = key[len(cur.prefix):]
+	}
+}
+
+func (t *Tree[V]) Dump() map[string]V {
+	var traverse func(n *node[V], m map[string]V)
+	traverse = func(n *node[V], m map[string]V) {
 		if n == nil {
 			return
 		}
@@ -185,16 +262,63 @@ func (t *RadixTree) Dump() map[string]interface{} {
 			traverse(e.n, m)
 		}
 	}
-	m := make(map[string]interface{})
+	m := make(map[string]V)
 	traverse(t.root, m)
 	return m
 }
 
-func (t *RadixTree) Size() int {
+// 删除所有以 prefix 为前缀的 key，返回删除的数量
+// 与 prefixNode 相同地下沉到覆盖 prefix 的最高节点，从父节点摘除整棵子树，父节点只剩一个子节点时上浮该子节点
+func (t *Tree[V]) DeletePrefix(prefix []byte) int {
+	var parent *node[V]
+	cur := t.root
+	for len(prefix) > 0 {
+		parent = cur
+		cur = cur.searchEdge(prefix[0])
+		if cur == nil {
+			return 0
+		}
+		if bytes.HasPrefix(prefix, cur.prefix) {
+			prefix = prefix[len(cur.prefix):] // 前缀被完全覆盖，继续下沉
+			continue
+		}
+		if bytes.HasPrefix(cur.prefix, prefix) {
+			break // prefix 在当前节点的前缀内结束
+		}
+		return 0
+	}
+
+	cnt := 0
+	cur.walk(func([]byte, V) bool {
+		cnt++
+		return true
+	})
+	if parent == nil {
+		t.Clear() // 空 prefix 即整棵树
+		return cnt
+	}
+	parent.deleteEdge(cur.prefix[0])
+	t.size -= cnt
+
+	// 根节点不能被替换；混合节点只剩一个子节点依旧合法
+	if parent != t.root && !parent.isLeafNode() && len(parent.edges) == 1 {
+		parent.replaceByOnlyChild()
+	}
+	return cnt
+}
+
+// 删除所有 key，root 替换为新的空节点
+func (t *Tree[V]) Clear() {
+	t.root = &node[V]{}
+	t.size = 0
+}
+
+func (t *Tree[V]) Size() int {
 	return t.size
 }
 
-func (t *RadixTree) Min() ([]byte, interface{}) {
+// 最小 key，空树则 k 为 nil
+func (t *Tree[V]) Min() (k []byte, v V) {
 	cur := t.root
 	for {
 		if cur.isLeafNode() {
@@ -204,11 +328,12 @@ func (t *RadixTree) Min() ([]byte, interface{}) {
 			cur = cur.edges[0].n
 			continue
 		}
-		return nil, nil
+		return nil, v
 	}
 }
 
-func (t *RadixTree) Max() ([]byte, interface{}) {
+// 最大 key，空树则 k 为 nil
+func (t *Tree[V]) Max() (k []byte, v V) {
 	cur := t.root
 	for {
 		if cur.isPrefixNode() {
@@ -218,6 +343,129 @@ func (t *RadixTree) Max() ([]byte, interface{}) {
 		if cur.isLeafNode() {
 			return cur.leaf.key, cur.leaf.val
 		}
-		return nil, nil
+		return nil, v
+	}
+}
+
+// 最后一个 <= key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Floor(key []byte) (k []byte, v V) {
+	it := &Iterator[V]{tree: t}
+	if it.SeekForPrev(key) {
+		return it.Key(), it.Value()
+	}
+	return nil, v
+}
+
+// 第一个 >= key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Ceiling(key []byte) (k []byte, v V) {
+	it := &Iterator[V]{tree: t}
+	if it.Seek(key) {
+		return it.Key(), it.Value()
+	}
+	return nil, v
+}
+
+// 最后一个 < key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Lower(key []byte) (k []byte, v V) {
+	it := &Iterator[V]{tree: t}
+	ok := it.Seek(key)
+	if ok {
+		ok = it.Prev() // 第一个 >= key 的前一个即 < key
+	} else {
+		ok = it.SeekToLast() // 所有 key 都 < key
+	}
+	if ok {
+		return it.Key(), it.Value()
+	}
+	return nil, v
+}
+
+// 第一个 > key 的 key，不存在则 k 为 nil
+func (t *Tree[V]) Higher(key []byte) (k []byte, v V) {
+	it := &Iterator[V]{tree: t}
+	ok := it.Seek(key)
+	if ok && bytes.Equal(it.Key(), key) {
+		ok = it.Next()
+	}
+	if ok {
+		return it.Key(), it.Value()
+	}
+	return nil, v
+}
+
+// 删除并返回最小 key，空树则 k 为 nil
+func (t *Tree[V]) PopMin() (k []byte, v V) {
+	if k, v = t.Min(); k != nil {
+		t.Delete(k) // 叶子被摘除后不再引用 k，可直接返回给调用方
+	}
+	return k, v
+}
+
+// 删除并返回最大 key，空树则 k 为 nil
+func (t *Tree[V]) PopMax() (k []byte, v V) {
+	if k, v = t.Max(); k != nil {
+		t.Delete(k)
+	}
+	return k, v
+}
+
+// 升序遍历 [start, end) 内的 key，start 为 nil 则从最小 key 开始，end 为 nil 则遍历到最大 key
+// 先 Seek 到 start 再逐个后移，区间外的子树不会被访问；fn 返回 false 则提前结束
+func (t *Tree[V]) Range(start, end []byte, fn func(k []byte, v V) bool) {
+	it := &Iterator[V]{tree: t}
+	ok := it.SeekToFirst()
+	if start != nil {
+		ok = it.Seek(start)
+	}
+	for ; ok; ok = it.Next() {
+		if end != nil && bytes.Compare(it.Key(), end) >= 0 {
+			return
+		}
+		if !fn(it.Key(), it.Value()) {
+			return
+		}
+	}
+}
+
+// 升序遍历所有以 prefix 为前缀的 key，fn 返回 false 则提前结束
+func (t *Tree[V]) WalkPrefix(prefix []byte, fn func(k []byte, v V) bool) {
+	if n := t.prefixNode(prefix); n != nil {
+		n.walk(fn)
+	}
+}
+
+func (t *Tree[V]) HasPrefix(prefix []byte) bool {
+	n := t.prefixNode(prefix)
+	return n != nil && (n.isLeafNode() || n.isPrefixNode()) // 空树的 root 两者都不是
+}
+
+func (t *Tree[V]) CountPrefix(prefix []byte) int {
+	cnt := 0
+	if n := t.prefixNode(prefix); n != nil {
+		n.walk(func([]byte, V) bool {
+			cnt++
+			return true
+		})
+	}
+	return cnt
+}
+
+// 下沉到覆盖 prefix 的最高节点，其子树中的 key 均以 prefix 为前缀
+func (t *Tree[V]) prefixNode(prefix []byte) *node[V] {
+	cur := t.root
+	for len(prefix) > 0 {
+		cur = cur.searchEdge(prefix[0])
+		if cur == nil {
+			return nil
+		}
+		if bytes.HasPrefix(prefix, cur.prefix) {
+			prefix = prefix[len(cur.prefix):] // 前缀被完全覆盖，继续下沉
+			continue
+		}
+		if bytes.HasPrefix(cur.prefix, prefix) {
+			return cur // prefix 在当前节点的前缀内结束
+		}
+		return nil
 	}
+	return cur
 }
@@ -1,9 +1,20 @@
 package radix
 
 import (
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"maps"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync/atomic"
 	"testing"
+	"time"
+	"trees"
+	"trees/conformance"
 	"trees/utils"
+	"unsafe"
 )
 
 func TestRadix(t *testing.T) {
@@ -34,6 +45,24 @@ func TestRadix(t *testing.T) {
 	assert.Equal(t, max, string(maxKey))
 }
 
+func TestGeneric(t *testing.T) {
+	tree := New[string]()
+	tree.Insert([]byte("roman"), "")
+	tree.Insert([]byte("romane"), "e")
+
+	v, ok := tree.Get([]byte("roman"))
+	assert.True(t, ok)
+	assert.Equal(t, "", v)
+	v, ok = tree.Get([]byte("rom"))
+	assert.False(t, ok)
+	assert.Equal(t, "", v)
+	assert.Equal(t, "e", tree.Search([]byte("romane")))
+
+	k, v := tree.Max()
+	assert.Equal(t, "romane", string(k))
+	assert.Equal(t, "e", v)
+}
+
 func TestInsertAndDelete(t *testing.T) {
 	tree := NewRadixTree()
 	tree.Insert([]byte("romane"), 31)
@@ -61,3 +90,403 @@ func TestDelete(t *testing.T) {
 		assert.Equal(t, inserted, existed)
 	}
 }
+
+func TestIterator(t *testing.T) {
+	tree := NewRadixTree()
+	assert.False(t, tree.Iterator().SeekToFirst())
+	assert.False(t, tree.Iterator().SeekToLast())
+
+	keys := []string{"", "r", "roman", "romane", "romanus", "romulus", "rubens", "ruber", "rubicon", "rubicundus"}
+	for _, k := range keys {
+		tree.Insert([]byte(k), k)
+	}
+
+	var got []string
+	for k, v := range tree.All() {
+		assert.Equal(t, string(k), v)
+		got = append(got, string(k))
+	}
+	assert.Equal(t, keys, got)
+	got = got[:0]
+	for k := range tree.Backward() {
+		got = append([]string{string(k)}, got...)
+	}
+	assert.Equal(t, keys, got)
+
+	it := tree.Iterator()
+	for _, k := range []string{"", "a", "r", "ro", "roman", "romana", "romanz", "rz", "rubicundusx", "s"} {
+		i := sort.SearchStrings(keys, k)
+		if i == len(keys) {
+			assert.False(t, it.Seek([]byte(k)))
+		} else {
+			assert.True(t, it.Seek([]byte(k)))
+			assert.Equal(t, keys[i], string(it.Key()), "seek %q", k)
+		}
+
+		if i < len(keys) && keys[i] == k {
+			i++
+		}
+		if i == 0 {
+			assert.False(t, it.SeekForPrev([]byte(k)))
+		} else {
+			assert.True(t, it.SeekForPrev([]byte(k)))
+			assert.Equal(t, keys[i-1], string(it.Key()), "seek for prev %q", k)
+		}
+	}
+
+	assert.True(t, it.Seek([]byte("romanus")))
+	assert.True(t, it.Prev())
+	assert.Equal(t, "romane", string(it.Key()))
+	assert.True(t, it.Prev())
+	assert.True(t, it.Prev())
+	assert.Equal(t, "r", string(it.Key()))
+	assert.True(t, it.Next())
+	assert.Equal(t, "roman", string(it.Key()))
+}
+
+func TestStats(t *testing.T) {
+	tree := New[int]()
+	for i, k := range []string{"ab", "abc", "abd"} {
+		tree.Insert([]byte(k), i)
+	}
+	s := tree.Stats()
+	assert.Equal(t, s.Keys, 3)
+	assert.Equal(t, s.Nodes, map[string]int{"prefix": 1, "mixed": 1, "leaf": 2}) // root -> "ab" -> "c"、"d"
+	assert.Equal(t, s.Depth, []int{0, 1, 2})
+	assert.Equal(t, s.Fanout, []int{0, 1, 1})
+	assert.Equal(t, s.PrefixLen, []int{0, 2, 1})
+	assert.True(t, s.BytesPerKey > 0)
+
+	// 前缀切自叶子的 key，共享的数组只计一次
+	fresh := New[int]()
+	fresh.Insert([]byte("abc"), 0)
+	size := 2*unsafe.Sizeof(node[int]{}) + unsafe.Sizeof(edge[int]{}) + unsafe.Sizeof(leaf[int]{}) + 3
+	assert.Equal(t, fresh.Stats().Bytes, int(size))
+
+	// 合并后的前缀是新分配的数组，需额外计入
+	merged := New[int]()
+	merged.Insert([]byte("abc"), 0)
+	merged.Insert([]byte("abd"), 1)
+	merged.Delete([]byte("abd"))
+	assert.Equal(t, merged.Stats().Bytes, fresh.Stats().Bytes+3)
+}
+
+func TestValidate(t *testing.T) {
+	build := func() *Tree[int] {
+		tree := New[int]()
+		for i, k := range []string{"ab", "abc", "abd", "b"} {
+			tree.Insert([]byte(k), i)
+		}
+		assert.Nil(t, tree.Validate())
+		return tree
+	}
+	for _, c := range []struct {
+		name    string
+		corrupt func(tree *Tree[int])
+		path    string
+		reason  string
+	}{
+		{"size", func(tree *Tree[int]) { tree.size-- }, "", "size 3, found 4 leaves"},
+		{"unsorted", func(tree *Tree[int]) {
+			es := tree.root.searchEdge('a').edges
+			es[0], es[1] = es[1], es[0]
+		}, "ab", "edges not sorted"},
+		{"edge label", func(tree *Tree[int]) { tree.root.edges[1].k = 'c' }, "", "edge 0x63 leads to prefix"},
+		{"single child", func(tree *Tree[int]) {
+			n := tree.root.searchEdge('a')
+			n.leaf = nil
+			n.deleteEdge('d')
+			tree.size -= 2
+		}, "ab", "prefix node with a single child"},
+		{"leaf key", func(tree *Tree[int]) { tree.root.searchEdge('b').leaf.key = []byte("x") }, "b", "leaf \"x\" does not match path"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			tree := build()
+			c.corrupt(tree)
+			var invalid *trees.InvalidNodeError
+			err := tree.Validate()
+			assert.True(t, errors.As(err, &invalid), "%v", err)
+			assert.Equal(t, string(invalid.Path), c.path)
+			assert.Contains(t, invalid.Reason, c.reason)
+		})
+	}
+}
+
+// 每个事务包含多次写入，所有已提交的版本都保持提交时的内容
+func TestImmutable(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	keys := utils.RandStrs(300, 1, 6)
+	cur := NewImmutable[int]()
+	model := map[string]int{}
+	var versions []*Immutable[int]
+	var models []map[string]int
+	for round := 0; round < 200; round++ {
+		txn := cur.Txn()
+		base := maps.Clone(model)
+		for op := 0; op < 1+r.Intn(20); op++ {
+			k := keys[r.Intn(len(keys))]
+			if r.Intn(3) == 0 {
+				old, ok := txn.Delete([]byte(k))
+				want, exists := model[k]
+				assert.Equal(t, ok, exists)
+				assert.Equal(t, old, want)
+				delete(model, k)
+			} else {
+				old, replaced := txn.Put([]byte(k), op)
+				want, exists := model[k]
+				assert.Equal(t, replaced, exists)
+				assert.Equal(t, old, want)
+				model[k] = op
+			}
+			assert.Equal(t, txn.Size(), len(model))
+		}
+		assert.Equal(t, cur.Dump(), base) // 提交前的写入对事务外不可见
+		cur = txn.Commit()
+		versions = append(versions, cur)
+		models = append(models, maps.Clone(model))
+	}
+	for i, v := range versions {
+		assert.Nil(t, v.Validate())
+		assert.Equal(t, v.Size(), len(models[i]))
+		for k, want := range models[i] {
+			got, ok := v.Get([]byte(k))
+			assert.True(t, ok)
+			assert.Equal(t, got, want)
+		}
+		assert.Equal(t, v.Dump(), models[i])
+	}
+}
+
+// 路由表：匹配最长的已存储前缀，混合节点与叶子节点都是候选
+func TestLongestPrefix(t *testing.T) {
+	tree := New[string]()
+	for _, k := range []string{"/", "/org", "/org/team", "/org/team/svc", "/other"} {
+		tree.Insert([]byte(k), k)
+	}
+	for q, want := range map[string]string{
+		"/org/team/svc/v1": "/org/team/svc",
+		"/org/team/sv":     "/org/team",
+		"/org/teams":       "/org/team",
+		"/or":              "/",
+		"/org":             "/org",
+		"/oth":             "/",
+	} {
+		k, v, ok := tree.LongestPrefix([]byte(q))
+		assert.True(t, ok)
+		assert.Equal(t, string(k), want, q)
+		assert.Equal(t, v, want)
+	}
+	_, _, ok := tree.LongestPrefix([]byte("org"))
+	assert.False(t, ok)
+}
+
+func TestWalkPath(t *testing.T) {
+	tree := New[string]()
+	for _, k := range []string{"", "/org", "/org/team", "/org/team/svc", "/org/teams", "/other"} {
+		tree.Insert([]byte(k), k)
+	}
+	path := func(key string, limit int) []string {
+		var got []string
+		tree.WalkPath([]byte(key), func(k []byte, v string) bool {
+			assert.Equal(t, string(k), v)
+			got = append(got, v)
+			return len(got) < limit
+		})
+		return got
+	}
+	assert.Equal(t, []string{"", "/org", "/org/team", "/org/team/svc"}, path("/org/team/svc/v1", 10))
+	assert.Equal(t, []string{"", "/org", "/org/team"}, path("/org/team/sv", 10))
+	assert.Equal(t, []string{"", "/org", "/org/team", "/org/teams"}, path("/org/teams", 10))
+	assert.Equal(t, []string{""}, path("/o", 10))
+	assert.Equal(t, []string{"", "/org"}, path("/org/team/svc", 2)) // 提前结束
+
+	tree.Delete(nil)
+	assert.Nil(t, path("org", 10))
+	assert.Equal(t, []string{"/other"}, path("/other/x", 10))
+}
+
+func TestDeletePrefix(t *testing.T) {
+	tree := New[int]()
+	for _, k := range []string{"tenant1/a", "tenant1/b", "tenant2/a", "tenant2/b/c"} {
+		tree.Insert([]byte(k), len(k))
+	}
+
+	// 摘除后前缀节点 "tenant" 只剩一个子节点，与其合并
+	assert.Equal(t, 2, tree.DeletePrefix([]byte("tenant2")))
+	assert.NoError(t, tree.Validate())
+	assert.Equal(t, 2, tree.Size())
+	assert.Equal(t, 0, tree.CountPrefix([]byte("tenant2")))
+	assert.Equal(t, 2, tree.CountPrefix([]byte("tenant1/")))
+
+	// 父节点为混合节点，只剩一个子节点依旧合法；prefix 在节点前缀内结束
+	tree.Insert([]byte("tenant"), 6)
+	tree.Insert([]byte("tenant3/x"), 9)
+	assert.Equal(t, 2, tree.DeletePrefix([]byte("tenant1/")))
+	assert.NoError(t, tree.Validate())
+	assert.Equal(t, 1, tree.DeletePrefix([]byte("tenant3")))
+	assert.NoError(t, tree.Validate())
+	assert.Equal(t, map[string]int{"tenant": 6}, tree.Dump())
+	assert.Equal(t, 0, tree.DeletePrefix([]byte("tenant1")))
+	assert.Equal(t, 0, tree.DeletePrefix([]byte("tenants")))
+
+	assert.Equal(t, 1, tree.DeletePrefix(nil))
+	assert.Equal(t, 0, tree.Size())
+	tree.Insert([]byte("tenant"), 6)
+	assert.Equal(t, 6, tree.Search([]byte("tenant")))
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func() trees.IndexTree { return NewRadixTree() })
+}
+
+func FuzzConformance(f *testing.F) {
+	conformance.Fuzz(f, func() trees.IndexTree { return NewRadixTree() })
+}
+
+// 事务内首次修改时拷贝节点，之后原地修改；未修改的子树在版本间共享
+func TestTxnCopyOnce(t *testing.T) {
+	v1 := NewImmutable[int]()
+	txn := v1.Txn()
+	for i, k := range []string{"a", "ab", "abc", "abd", "b", "ba", "bb", "c"} {
+		txn.Insert([]byte(k), i)
+	}
+	// 每个节点只拷贝或新建一次，没有被丢弃的中间拷贝
+	assert.Equal(t, len(txn.written), countNodes(txn.root))
+	v2 := txn.Commit()
+	assert.Nil(t, v2.Validate())
+	assert.Equal(t, v1.Size(), 0)
+
+	v3, old, ok := v2.Delete([]byte("ab"))
+	assert.True(t, ok)
+	assert.Equal(t, old, 1)
+	assert.True(t, v3.tree.root != v2.tree.root)
+	assert.True(t, v3.tree.root.searchEdge('b') == v2.tree.root.searchEdge('b'))
+	assert.True(t, v3.tree.root.searchEdge('c') == v2.tree.root.searchEdge('c'))
+	assert.Nil(t, v3.Validate())
+	assert.Equal(t, v2.Search([]byte("ab")), 1)
+
+	// 提交后继续使用事务，不影响已提交的版本
+	txn.Delete([]byte("a"))
+	txn.Insert([]byte("abe"), 8)
+	assert.Nil(t, txn.Commit().Validate())
+	assert.Equal(t, v2.Size(), 8)
+	_, ok = v2.Get([]byte("abe"))
+	assert.False(t, ok)
+	assert.Nil(t, v2.Validate())
+
+	// 合并后的节点接管了旧版本子节点的边，之后在同一事务内修改不能影响旧版本
+	base := NewImmutable[int]().Insert([]byte("a"), 0).Insert([]byte("abc"), 1).Insert([]byte("abd"), 2)
+	txn = base.Txn()
+	txn.Delete([]byte("a"))
+	txn.Delete([]byte("abc"))
+	txn.Insert([]byte("abb"), 3)
+	assert.Nil(t, txn.Commit().Validate())
+	assert.Nil(t, base.Validate())
+	assert.Equal(t, base.Dump(), map[string]int{"a": 0, "abc": 1, "abd": 2})
+
+	// 不存在的 key 不产生新版本
+	v4, _, ok := v2.Delete([]byte("zz"))
+	assert.False(t, ok)
+	assert.True(t, v4 == v2)
+	v5, existing, loaded := v2.PutIfAbsent([]byte("c"), -1)
+	assert.True(t, loaded)
+	assert.Equal(t, existing, 7)
+	assert.True(t, v5 == v2)
+}
+
+func countNodes[V any](n *node[V]) int {
+	cnt := 1
+	for _, e := range n.edges {
+		cnt += countNodes(e.n)
+	}
+	return cnt
+}
+
+// 只有被替换的最小子树或叶子上的 channel 被关闭
+func TestWatch(t *testing.T) {
+	v := NewImmutable[int]()
+	for i, k := range []string{"user/alice", "user/bob", "svc/api", "svc/db"} {
+		v = v.Insert([]byte(k), i)
+	}
+	user, alice, carol := v.WatchPrefix([]byte("user/")), v.WatchKey([]byte("user/alice")), v.WatchKey([]byte("user/carol"))
+	us := v.WatchPrefix([]byte("us")) // 在节点前缀中途结束，与 "user/" 为同一个节点
+	assert.True(t, us == user)
+
+	// 其它子树的修改不影响
+	v = v.Insert([]byte("svc/cache"), 4)
+	assert.False(t, isClosed(user) || isClosed(alice) || isClosed(carol))
+
+	// 同一子树下其它 key 的更新不影响已存在 key 的 watch
+	v = v.Insert([]byte("user/bob"), 5)
+	assert.True(t, isClosed(user))
+	assert.False(t, isClosed(alice))
+	assert.True(t, isClosed(carol)) // 不存在的 key 关注其必经的节点
+
+	// 事务提交前不通知，提交后更新和删除都会关闭叶子的 watch
+	alice, user = v.WatchKey([]byte("user/alice")), v.WatchPrefix([]byte("user/"))
+	txn := v.Txn()
+	txn.Delete([]byte("user/alice"))
+	assert.False(t, isClosed(alice) || isClosed(user))
+	next := txn.Commit()
+	assert.True(t, isClosed(alice) && isClosed(user))
+
+	// 已被替换的旧版本节点直接返回关闭的 channel
+	assert.True(t, isClosed(v.WatchPrefix([]byte("user/"))))
+	assert.False(t, isClosed(next.WatchPrefix([]byte("user/"))))
+	assert.False(t, isClosed(next.WatchPrefix([]byte("nothing"))))
+}
+
+// 读者在写者提交的同时 Watch，需配合 go test -race
+func TestWatchConcurrent(t *testing.T) {
+	var cur atomic.Pointer[Immutable[int]]
+	cur.Store(NewImmutable[int]().Insert([]byte("key/0"), 0))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i < 200; i++ {
+			cur.Store(cur.Load().Insert([]byte(fmt.Sprintf("key/%d", i%10)), i))
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		v := cur.Load()
+		ch := v.WatchPrefix([]byte("key/"))
+		if v != cur.Load() {
+			<-ch // 已有更新的版本，channel 必然已关闭或即将关闭
+		}
+	}
+	<-done
+	ch := cur.Load().WatchKey([]byte("key/3"))
+	cur.Store(cur.Load().Insert([]byte("key/3"), -1))
+	<-ch
+}
+
+// 旁路表不延长被替换节点的生命周期，旧版本被回收后条目随之删除
+func TestWatchRelease(t *testing.T) {
+	v := NewImmutable[int]()
+	w := v.watches
+	for i := 0; i < 100; i++ {
+		v.WatchPrefix([]byte("key/"))
+		v = v.Insert([]byte(fmt.Sprintf("key/%d", i%10)), i)
+	}
+	size := func() int {
+		w.nodes.mu.Lock()
+		defer w.nodes.mu.Unlock()
+		return len(w.nodes.chs)
+	}
+	assert.True(t, size() > 0)
+	for i := 0; i < 100 && size() > 0; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, size())
+	runtime.KeepAlive(v)
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
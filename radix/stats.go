@@ -0,0 +1,60 @@
+package radix
+
+import (
+	"trees"
+	"unsafe"
+)
+
+// 遍历整棵树统计结构，节点分为 leaf、prefix 和 mixed 三类，root 没有叶子时计为 prefix
+// 深度为从 root 到 key 所在节点经过的边数
+func (t *Tree[V]) Stats() trees.Stats {
+	s := trees.Stats{Keys: t.size, Nodes: make(map[string]int)}
+	arrays := make(map[uintptr]int)
+	t.root.stats(&s, 0, arrays)
+	for _, size := range arrays {
+		s.Bytes += size
+	}
+	if s.Keys > 0 {
+		s.BytesPerKey = float64(s.Bytes) / float64(s.Keys)
+	}
+	return s
+}
+
+// 前缀通常切自某个叶子的 key，与其共享底层数组；合并节点后的前缀则是新分配的数组，被删除的叶子的 key 也可能仍被前缀引用
+// 因此前缀和 key 的字节按底层数组去重后再计入，见 observeArray
+func (n *node[V]) stats(s *trees.Stats, depth int, arrays map[uintptr]int) {
+	switch {
+	case n.isMixedNode():
+		s.Nodes["mixed"]++
+	case n.isLeafNode():
+		s.Nodes["leaf"]++
+	default:
+		s.Nodes["prefix"]++
+	}
+	s.Bytes += int(unsafe.Sizeof(*n)) + cap(n.edges)*int(unsafe.Sizeof(edge[V]{}))
+	if n.isLeafNode() {
+		s.Bytes += int(unsafe.Sizeof(*n.leaf))
+		observeArray(arrays, n.leaf.key)
+		s.Depth = trees.Observe(s.Depth, depth)
+	}
+	if n.isPrefixNode() {
+		s.Fanout = trees.Observe(s.Fanout, len(n.edges))
+	}
+	if depth > 0 {
+		s.PrefixLen = trees.Observe(s.PrefixLen, len(n.prefix))
+	}
+	observeArray(arrays, n.prefix)
+	for _, e := range n.edges {
+		e.n.stats(s, depth+1, arrays)
+	}
+}
+
+// 以数组末尾的地址标识底层数组，切自同一数组的切片末尾相同，取其中最大的 cap 作为数组的大小
+// 只作为 map 的 key 使用，不转换回指针
+func observeArray(arrays map[uintptr]int, b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+	end := uintptr(unsafe.Pointer(unsafe.SliceData(b))) + uintptr(cap(b))
+	arrays[end] = max(arrays[end], cap(b))
+}
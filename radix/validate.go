@@ -0,0 +1,55 @@
+package radix
+
+import (
+	"bytes"
+	"trees"
+)
+
+// 校验树的结构不变量，返回第一处错误及出错节点的完整前缀，用于测试和调试
+// 包括：size 与叶子数一致，边按 key 严格升序且与子节点前缀的首字节一致，叶子的 key 等于完整前缀，
+// root 以外不存在空节点或只有一个子节点的前缀节点
+func (t *Tree[V]) Validate() error {
+	if len(t.root.prefix) != 0 {
+		return trees.Invalid(nil, "root has prefix %q", t.root.prefix)
+	}
+	cnt := 0
+	if err := t.root.validate(nil, true, &cnt); err != nil {
+		return err
+	}
+	if cnt != t.size {
+		return trees.Invalid(nil, "size %d, found %d leaves", t.size, cnt)
+	}
+	return nil
+}
+
+// path 为从 root 到 n 的完整前缀，包含 n 自身的前缀
+func (n *node[V]) validate(path []byte, root bool, cnt *int) error {
+	if n.isLeafNode() {
+		*cnt++
+		if !bytes.Equal(n.leaf.key, path) {
+			return trees.Invalid(path, "leaf %q does not match path", n.leaf.key)
+		}
+	}
+	if !root && !n.isLeafNode() {
+		switch len(n.edges) {
+		case 0:
+			return trees.Invalid(path, "empty node")
+		case 1:
+			return trees.Invalid(path, "prefix node with a single child")
+		}
+	}
+	for i, e := range n.edges {
+		switch {
+		case i > 0 && e.k <= n.edges[i-1].k:
+			return trees.Invalid(path, "edges not sorted at %#x", e.k)
+		case e.n == nil:
+			return trees.Invalid(path, "edge %#x is nil", e.k)
+		case len(e.n.prefix) == 0 || e.n.prefix[0] != e.k:
+			return trees.Invalid(path, "edge %#x leads to prefix %q", e.k, e.n.prefix)
+		}
+		if err := e.n.validate(append(path[:len(path):len(path)], e.n.prefix...), false, cnt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package radix
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+	"weak"
+)
+
+// 节点或叶子被替换时关闭的通知 channel，记录在同一 Immutable 的所有版本共享的旁路表中
+// 可变的 Tree 原地修改节点，不支持 Watch，节点本身不为此占用任何内存
+type watches[V any] struct {
+	nodes  watchTable[node[V]] // 被事务拷贝、合并时关闭，见 Immutable.WatchPrefix
+	leaves watchTable[leaf[V]] // 被替换或删除时关闭，见 Immutable.WatchKey
+}
+
+// 以弱指针为 key，不延长节点的生命周期，节点被回收后条目随之删除
+type watchTable[T any] struct {
+	mu  sync.Mutex
+	chs map[weak.Pointer[T]]chan struct{}
+}
+
+// 已关闭的 channel，节点先被替换、后被 Watch 时直接返回
+var closedCh = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// 首次 Watch 时才创建 channel，不被 Watch 的节点不分配
+func (w *watchTable[T]) get(p *T) <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	k := weak.Make(p)
+	ch, ok := w.chs[k]
+	if !ok {
+		ch = make(chan struct{})
+		w.add(p, k, ch)
+	}
+	return ch
+}
+
+// 被替换的节点仍可能从旧版本被 Watch，未被 Watch 过的也需记为已关闭
+func (w *watchTable[T]) close(ps []*T) {
+	if len(ps) == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, p := range ps {
+		k := weak.Make(p)
+		ch, ok := w.chs[k]
+		switch {
+		case !ok:
+			w.add(p, k, closedCh)
+		case ch != closedCh:
+			close(ch)
+			w.chs[k] = closedCh
+		}
+	}
+}
+
+func (w *watchTable[T]) add(p *T, k weak.Pointer[T], ch chan struct{}) {
+	if w.chs == nil {
+		w.chs = make(map[weak.Pointer[T]]chan struct{})
+	}
+	w.chs[k] = ch
+	runtime.AddCleanup(p, w.remove, k) // 回调不能引用 p，否则 p 永远不会被回收
+}
+
+func (w *watchTable[T]) remove(k weak.Pointer[T]) {
+	w.mu.Lock()
+	delete(w.chs, k)
+	w.mu.Unlock()
+}
+
+// 返回 key 被写入、更新或删除时关闭的 channel
+// key 存在时只关注其叶子，写入其它 key 不会关闭；不存在时关注写入 key 必经的最深节点，该节点下的任意修改都会关闭
+func (t *Immutable[V]) WatchKey(key []byte) <-chan struct{} {
+	n, rest := t.tree.seek(key)
+	if len(rest) == 0 && n.isLeafNode() {
+		return t.watches.leaves.get(n.leaf)
+	}
+	return t.watches.nodes.get(n)
+}
+
+// 返回任意以 prefix 为前缀的 key 被写入、更新或删除时关闭的 channel
+// 关注恰好包含所有这些 key 的最小子树，其它子树的修改不会关闭
+func (t *Immutable[V]) WatchPrefix(prefix []byte) <-chan struct{} {
+	n, rest := t.tree.seek(prefix)
+	if len(rest) > 0 {
+		if child := n.searchEdge(rest[0]); child != nil && bytes.HasPrefix(child.prefix, rest) {
+			return t.watches.nodes.get(child) // prefix 在子节点的前缀内结束
+		}
+	}
+	return t.watches.nodes.get(n)
+}
+
+// 沿 key 下沉，返回前缀被完全匹配的最深节点，以及 key 剩余未匹配的部分
+func (t *Tree[V]) seek(key []byte) (*node[V], []byte) {
+	cur := t.root
+	for len(key) > 0 {
+		next := cur.searchEdge(key[0])
+		if next == nil || !bytes.HasPrefix(key, next.prefix) {
+			break
+		}
+		cur, key = next, key[len(next.prefix):]
+	}
+	return cur, key
+}
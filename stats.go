@@ -0,0 +1,58 @@
+package trees
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// 树的结构统计，由各个树的 Stats() 遍历整棵树得到，用于比较不同的树在同一数据集上的形态和内存占用
+// 直方图以取值为下标，值为对应的数量
+type Stats struct {
+	Keys  int
+	Nodes map[string]int // 各类节点的数量，节点类型名由各个树定义
+
+	// 节点、叶子和 key 占用的字节数，按结构体大小和切片容量估算，不含 value 引用的内存
+	Bytes       int
+	BytesPerKey float64
+
+	Depth     []int // key 的深度，即从 root 到 key 经过的节点数
+	Fanout    []int // 内部节点的子节点数
+	PrefixLen []int // 内部节点的压缩前缀长度
+
+	OptimisticPrefixes int // 前缀超过存储长度，查找时跳过剩余部分、由叶子校验的节点数
+}
+
+// 累加到直方图，按需扩容
+func Observe(hist []int, v int) []int {
+	if v >= len(hist) {
+		hist = append(hist, make([]int, v+1-len(hist))...)
+	}
+	hist[v]++
+	return hist
+}
+
+func (s Stats) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "keys: %d, bytes: %d (%.1f/key)\n", s.Keys, s.Bytes, s.BytesPerKey)
+	sb.WriteString("nodes:")
+	for _, name := range slices.Sorted(maps.Keys(s.Nodes)) {
+		fmt.Fprintf(&sb, " %s=%d", name, s.Nodes[name])
+	}
+	sb.WriteString("\n")
+	for _, h := range []struct {
+		name string
+		hist []int
+	}{{"depth", s.Depth}, {"fanout", s.Fanout}, {"prefix len", s.PrefixLen}} {
+		sb.WriteString(h.name + ":")
+		for v, cnt := range h.hist {
+			if cnt > 0 {
+				fmt.Fprintf(&sb, " %d=%d", v, cnt)
+			}
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "optimistic prefixes: %d", s.OptimisticPrefixes)
+	return sb.String()
+}
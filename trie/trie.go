@@ -1,36 +1,79 @@
 package trie
 
-type TrieTree struct {
-	root *node
+import (
+	"fmt"
+	"trees"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// 值类型为 V 的字典树
+type Tree[V any] struct {
+	root *node[V]
 	size int
 }
 
-func newTrie() *TrieTree {
-	return &TrieTree{
-		root: newNode(false, nil),
+// 兼容存储 interface{} 的旧版 API
+type TrieTree = Tree[interface{}]
+
+// key 为只含小写字母的 string，且 Insert 沿用旧版的返回值，不实现 trees.Tree，只遵循 Get/Put/PutIfAbsent/Delete 的语义
+// 非法 key 由 Put/PutIfAbsent panic，而不是静默丢弃
+var _ trees.Map[string, int] = (*Tree[int])(nil)
+
+func New[V any]() *Tree[V] {
+	var zero V
+	return &Tree[V]{
+		root: newNode(false, zero),
 		size: 0,
 	}
 }
 
-type node struct {
+func newTrie() *TrieTree {
+	return New[interface{}]()
+}
+
+type node[V any] struct {
 	isEnd bool
-	val   interface{}
-	nexts map[rune]*node // 限制小写字母 key
+	val   V
+	nexts map[rune]*node[V] // 限制小写字母 key
 }
 
-func newNode(isEnd bool, val interface{}) *node {
-	return &node{
+func newNode[V any](isEnd bool, val V) *node[V] {
+	return &node[V]{
 		val:   val,
 		isEnd: isEnd,
-		nexts: make(map[rune]*node),
+		nexts: make(map[rune]*node[V]),
 	}
 }
 
-func (t *TrieTree) Insert(k string, v interface{}) (interface{}, bool) {
+// 兼容旧版 API 的新增或更新，ok 标识 k 是否合法，非小写字母的 k 不会写入
+func (t *Tree[V]) Insert(k string, v V) (V, bool) {
 	if !isLower(k) {
-		return nil, false
+		var zero V
+		return zero, false
 	}
+	old, _ := t.Put(k, v)
+	return old, true
+}
+
+// 新增或更新，replaced 标识 k 是否已存在，old 为被覆盖的旧值
+// 非小写字母的 k 会 panic，否则无法与写入新 key 区分；需要校验 k 的调用方使用 Insert
+func (t *Tree[V]) Put(k string, v V) (old V, replaced bool) {
+	return t.insert(k, v, true)
+}
 
+// 仅在 k 不存在时写入，loaded 标识 k 是否已存在，existing 为已存在的值
+// 与 Put 相同，非小写字母的 k 会 panic
+func (t *Tree[V]) PutIfAbsent(k string, v V) (existing V, loaded bool) {
+	return t.insert(k, v, false)
+}
+
+func (t *Tree[V]) insert(k string, v V, overwrite bool) (old V, ok bool) {
+	if !isLower(k) {
+		panic(fmt.Sprintf("trie: key %q is not lowercase", k))
+	}
+
+	var zero V
 	cur := t.root
 	for _, r := range k {
 		if next, ok := cur.nexts[r]; ok {
@@ -38,67 +81,87 @@ func (t *TrieTree) Insert(k string, v interface{}) (interface{}, bool) {
 			continue
 		}
 		if cur.nexts == nil {
-			cur.nexts = make(map[rune]*node)
+			cur.nexts = make(map[rune]*node[V])
 		}
-		cur.nexts[r] = newNode(false, nil)
+		cur.nexts[r] = newNode(false, zero)
 		cur = cur.nexts[r]
 	}
-	old := cur.val
-	cur.val = v
 	if cur.isEnd {
+		old = cur.val
+		if overwrite {
+			cur.val = v
+		}
 		return old, true
 	}
 	t.size++
 	cur.isEnd = true
-	return nil, true
+	cur.val = v
+	return
 }
 
-func (t *TrieTree) Get(k string) (interface{}, bool) {
+// 查找，ok 标识 k 是否存在，内部路径上的节点不算存在
+// 非小写字母的 k 不可能被写入，总是不存在
+func (t *Tree[V]) Get(k string) (v V, ok bool) {
 	if !isLower(k) {
-		return nil, false
+		return
 	}
 	cur := t.root
 	for _, r := range k {
 		next, ok := cur.nexts[r]
 		if !ok || next == nil {
-			return nil, false
+			return v, false
 		}
 		cur = next
 	}
+	if !cur.isEnd {
+		return
+	}
 	return cur.val, true
 }
 
-func (t *TrieTree) Delete(k string) (interface{}, bool) {
+// 删除，ok 标识 k 是否存在，old 为被删除的值，非小写字母的 k 总是不存在
+// 删除后回溯清理不再通向任何 key 的节点
+func (t *Tree[V]) Delete(k string) (old V, ok bool) {
 	if !isLower(k) {
-		return nil, false
+		return
 	}
+	path := make([]*node[V], 0, len(k)+1) // 从 root 到目标节点的路径
 	cur := t.root
+	path = append(path, cur)
 	for _, r := range k {
 		next, ok := cur.nexts[r]
 		if !ok || next == nil {
-			return nil, false
+			return old, false
 		}
 		cur = next
+		path = append(path, cur)
 	}
 	if !cur.isEnd {
-		return nil, false
+		return
 	}
 
 	// 找到 key
-	old := cur.val
-	cur.val = nil
-	// TODO: 回溯向上清理 KEY
-	// 思路1：每个 node 记录 parent 地址，回溯判断 len(n.nexts) == 0 则可删除
-	// 思路2：daemon 线程定期清理
-	// if len(cur.nexts) == 0 && parent != nil {
-	// }
+	var zero V
+	old = cur.val
+	cur.val = zero
+	cur.isEnd = false
 	t.size--
+
+	// 自底向上删除无后继的非 key 节点，root 保留
+	rs := []rune(k)
+	for i := len(rs); i > 0; i-- {
+		n := path[i]
+		if n.isEnd || len(n.nexts) > 0 {
+			break
+		}
+		delete(path[i-1].nexts, rs[i-1])
+	}
 	return old, true
 }
 
-func (t *TrieTree) Dump() map[string]interface{} {
-	var traverse func(s string, n *node, m map[string]interface{})
-	traverse = func(s string, n *node, m map[string]interface{}) {
+func (t *Tree[V]) Dump() map[string]V {
+	var traverse func(s string, n *node[V], m map[string]V)
+	traverse = func(s string, n *node[V], m map[string]V) {
 		if n.isEnd {
 			m[s] = n.val
 		}
@@ -108,15 +171,74 @@ func (t *TrieTree) Dump() map[string]interface{} {
 			}
 		}
 	}
-	m := make(map[string]interface{})
+	m := make(map[string]V)
 	traverse("", t.root, m)
 	return m
 }
 
-func (t *TrieTree) Size() int {
+func (t *Tree[V]) Size() int {
 	return t.size
 }
 
+// 遍历整棵树统计结构，每个节点对应一个字符，没有压缩前缀
+// 深度即 key 的字符数，map 按每个元素一个 rune 和一个指针估算，不含其内部的额外开销
+func (t *Tree[V]) Stats() trees.Stats {
+	s := trees.Stats{Keys: t.size, Nodes: make(map[string]int)}
+	t.root.stats(&s, 0)
+	if s.Keys > 0 {
+		s.BytesPerKey = float64(s.Bytes) / float64(s.Keys)
+	}
+	return s
+}
+
+func (n *node[V]) stats(s *trees.Stats, depth int) {
+	s.Nodes["node"]++
+	s.Bytes += int(unsafe.Sizeof(*n)) + len(n.nexts)*int(unsafe.Sizeof(rune(0))+unsafe.Sizeof(n))
+	if n.isEnd {
+		s.Depth = trees.Observe(s.Depth, depth)
+	}
+	if len(n.nexts) > 0 {
+		s.Fanout = trees.Observe(s.Fanout, len(n.nexts))
+	}
+	for _, next := range n.nexts {
+		next.stats(s, depth+1)
+	}
+}
+
+// 校验树的结构不变量，返回第一处错误及从 root 到出错节点经过的字符，用于测试和调试
+// 包括：size 与 key 数一致，只有小写字母，root 以外不存在不通向任何 key 的死分支
+func (t *Tree[V]) Validate() error {
+	cnt := 0
+	if err := t.root.validate(nil, true, &cnt); err != nil {
+		return err
+	}
+	if cnt != t.size {
+		return trees.Invalid(nil, "size %d, found %d keys", t.size, cnt)
+	}
+	return nil
+}
+
+func (n *node[V]) validate(path []byte, root bool, cnt *int) error {
+	if n.isEnd {
+		*cnt++
+	} else if !root && len(n.nexts) == 0 {
+		return trees.Invalid(path, "dead branch")
+	}
+	for r, next := range n.nexts {
+		p := utf8.AppendRune(path[:len(path):len(path)], r)
+		switch {
+		case next == nil:
+			return trees.Invalid(p, "nil node")
+		case !isLower(string(r)):
+			return trees.Invalid(p, "non-lowercase rune %q", r)
+		}
+		if err := next.validate(p, false, cnt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func isLower(s string) bool {
 	for _, r := range s {
 		if r-'a' < 0 || r-'a' >= 26 {
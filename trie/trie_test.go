@@ -1,15 +1,18 @@
 package trie
 
 import (
+	"errors"
+	"slices"
 	"strings"
 	"testing"
+	"trees"
 	"trees/utils"
 )
 
 func TestTrie(t *testing.T) {
 	trie := newTrie()
 	m := make(map[string]bool)
-	for _, s := range utils.RandStrs(10000) {
+	for _, s := range utils.RandStrs(10000, 1, 10) {
 		s = strings.ToLower(s)
 		v := utils.RandStr(10)
 		m[s] = true
@@ -19,7 +22,7 @@ func TestTrie(t *testing.T) {
 		t.Fatalf("unexpected trie size: %d, want %d", trie.size, len(m))
 	}
 
-	for _, s := range utils.RandStrs(10000) {
+	for _, s := range utils.RandStrs(10000, 1, 10) {
 		if _, ok := m[s]; !ok {
 			m[s] = false
 		}
@@ -44,3 +47,108 @@ func TestInsert(t *testing.T) {
 		t.Fatalf("invalid value:%s", v)
 	}
 }
+
+func TestContract(t *testing.T) {
+	trie := New[int]()
+	if _, replaced := trie.Put("abc", 1); replaced {
+		t.Fatal("put new key replaced")
+	}
+	if _, ok := trie.Get("ab"); ok {
+		t.Fatal("internal path should not exist")
+	}
+	if old, replaced := trie.Put("abc", 2); !replaced || old != 1 {
+		t.Fatalf("put existed key, got old %d replaced %t", old, replaced)
+	}
+	if existing, loaded := trie.PutIfAbsent("abc", 3); !loaded || existing != 2 {
+		t.Fatalf("put if absent, got existing %d loaded %t", existing, loaded)
+	}
+	if _, loaded := trie.PutIfAbsent("ab", 4); loaded {
+		t.Fatal("put if absent on internal path loaded")
+	}
+
+	// 删除后 "abc" 的分支被清理，"ab" 保留
+	if old, ok := trie.Delete("abc"); !ok || old != 2 {
+		t.Fatalf("delete, got old %d ok %t", old, ok)
+	}
+	if _, ok := trie.Get("abc"); ok {
+		t.Fatal("deleted key still exists")
+	}
+	if n := trie.root.nexts['a'].nexts['b']; len(n.nexts) != 0 {
+		t.Fatalf("dead branch left after delete: %v", n.nexts)
+	}
+	if old, ok := trie.Delete("ab"); !ok || old != 4 {
+		t.Fatalf("delete, got old %d ok %t", old, ok)
+	}
+	if len(trie.root.nexts) != 0 || trie.Size() != 0 {
+		t.Fatal("trie should be empty")
+	}
+}
+
+// 非法 key：Put / PutIfAbsent panic，Insert 返回 false，Get / Delete 总是不存在，均不写入
+func TestInvalidKey(t *testing.T) {
+	trie := New[int]()
+	for _, k := range []string{"Abc", "ab1", "a b", "é"} {
+		for name, put := range map[string]func(){
+			"put":           func() { trie.Put(k, 1) },
+			"put if absent": func() { trie.PutIfAbsent(k, 1) },
+		} {
+			if !panics(put) {
+				t.Fatalf("%s invalid key %q should panic", name, k)
+			}
+		}
+		if _, ok := trie.Insert(k, 1); ok {
+			t.Fatalf("insert invalid key %q ok", k)
+		}
+		if _, ok := trie.Get(k); ok {
+			t.Fatalf("get invalid key %q ok", k)
+		}
+		if _, ok := trie.Delete(k); ok {
+			t.Fatalf("delete invalid key %q ok", k)
+		}
+	}
+	if trie.Size() != 0 || len(trie.root.nexts) != 0 {
+		t.Fatal("invalid keys should not be written")
+	}
+}
+
+func panics(fn func()) (ok bool) {
+	defer func() { ok = recover() != nil }()
+	fn()
+	return
+}
+
+func TestStats(t *testing.T) {
+	trie := New[int]()
+	for i, k := range []string{"ab", "abc", "abd"} {
+		trie.Put(k, i)
+	}
+	s := trie.Stats()
+	if s.Keys != 3 || s.Nodes["node"] != 5 {
+		t.Fatalf("got keys %d nodes %v", s.Keys, s.Nodes)
+	}
+	if !slices.Equal(s.Depth, []int{0, 0, 1, 2}) || !slices.Equal(s.Fanout, []int{0, 2, 1}) || s.PrefixLen != nil {
+		t.Fatalf("got depth %v fanout %v prefix len %v", s.Depth, s.Fanout, s.PrefixLen)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	trie := New[int]()
+	for i, k := range []string{"ab", "abc", "b"} {
+		trie.Put(k, i)
+	}
+	if err := trie.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 绕过 Delete 直接摘除 key，留下不通向任何 key 的 "abc" 节点
+	trie.root.nexts['a'].nexts['b'].nexts['c'].isEnd = false
+	trie.size--
+	var invalid *trees.InvalidNodeError
+	if err := trie.Validate(); !errors.As(err, &invalid) || string(invalid.Path) != "abc" || invalid.Reason != "dead branch" {
+		t.Fatalf("got %v", err)
+	}
+	trie.root.nexts['a'].nexts['b'].nexts['c'].isEnd = true
+	if err := trie.Validate(); err == nil || err.Error() != `invalid node at "": size 2, found 3 keys` {
+		t.Fatalf("got %v", err)
+	}
+}
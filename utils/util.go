@@ -49,6 +49,11 @@ func RandStrs(count int, minLen, maxLen int) []string {
 	return strs
 }
 
+// 生成长度为 length 的随机字符串
+func RandStr(length int) string {
+	return randSizeStr(length)
+}
+
 func randSizeStr(length int) string {
 	buf := make([]rune, length)
 	for i := range buf {
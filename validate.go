@@ -0,0 +1,21 @@
+package trees
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// 树的 Validate 发现的结构错误
+type InvalidNodeError struct {
+	Path   []byte // 从 root 到出错节点的路径，art 为依次经过的子节点 key，radix 为完整前缀，trie 为经过的字符
+	Reason string
+}
+
+func (e *InvalidNodeError) Error() string {
+	return fmt.Sprintf("invalid node at %q: %s", e.Path, e.Reason)
+}
+
+// 构造 InvalidNodeError，拷贝调用方的 path
+func Invalid(path []byte, format string, args ...any) error {
+	return &InvalidNodeError{Path: bytes.Clone(path), Reason: fmt.Sprintf(format, args...)}
+}